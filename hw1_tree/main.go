@@ -6,68 +6,496 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 )
 
-func dirTreeRec(out io.Writer, path string, printFiles bool, dirPrefix string) (ferr error) {
-	files, err := ioutil.ReadDir(path)
+func dirTreeRec(out io.Writer, nodes []*treeNode, printFiles bool, dirPrefix string) {
+	nodes = visibleNodes(nodes, printFiles)
+
+	dirChildPrefix := dirPrefix + "├───"
+	childDirPrefix := dirPrefix + "│\t"
+
+	for i, node := range nodes {
+		if i == len(nodes)-1 {
+			dirChildPrefix = dirPrefix + "└───"
+			childDirPrefix = dirPrefix + "\t"
+		}
+
+		fmt.Fprintf(out, "%s%s\n", dirChildPrefix, node.label())
+
+		if node.isDir {
+			dirTreeRec(out, node.children, printFiles, childDirPrefix)
+		}
+	}
+}
+
+func formatSize(size int64) string {
+	if size == 0 {
+		return "empty"
+	}
+	return strconv.FormatInt(size, 10) + "b"
+}
+
+func dirTree(out io.Writer, path string, printFiles bool) (ferr error) {
+	nodes, ferr := readTree(path)
+	if ferr != nil {
+		return
+	}
 
+	dirTreeRec(out, nodes, printFiles, "")
+	return
+}
+
+type treeNode struct {
+	name     string
+	path     string
+	isDir    bool
+	mode     os.FileMode
+	size     int64
+	modTime  time.Time
+	children []*treeNode
+}
+
+func (n *treeNode) label() string {
+	if n.isDir {
+		return n.name
+	}
+	return n.name + " (" + formatSize(n.size) + ")"
+}
+
+// readTree returns the entries under path. Only an error of path itself is
+// returned: a subdirectory that cannot be read is kept without children.
+func readTree(path string) (nodes []*treeNode, ferr error) {
+	files, err := ioutil.ReadDir(path)
 	if err != nil {
 		ferr = err
 		return
-	} else {
-		i_lastprinted := -1
-		for i, file := range files {
-			if file.IsDir() || printFiles {
-				i_lastprinted = i
+	}
+
+	for _, file := range files {
+		node := &treeNode{
+			name:    file.Name(),
+			path:    filepath.Join(path, file.Name()),
+			isDir:   file.IsDir(),
+			mode:    file.Mode(),
+			size:    file.Size(),
+			modTime: file.ModTime(),
+		}
+
+		// sizes of the files symlinks point to, as os.Stat gives them
+		if node.mode&os.ModeSymlink != 0 {
+			if info, err := os.Stat(node.path); err == nil {
+				node.size = info.Size()
 			}
 		}
 
-		dirChildPrefix := dirPrefix + "├───"
-		childDirPrefix := dirPrefix + "│\t"
+		if node.isDir {
+			node.children, _ = readTree(node.path)
 
-		for i, file := range files {
-			if i == i_lastprinted {
-				dirChildPrefix = dirPrefix + "└───"
-				childDirPrefix = dirPrefix + "\t"
+			node.size = 0
+			for _, child := range node.children {
+				node.size += child.size
 			}
+		}
 
-			if file.IsDir() {
-				fmt.Fprintf(out, "%s%s\n", dirChildPrefix, file.Name())
-
-				dirTreeRec(out, filepath.Join(path, file.Name()), printFiles, childDirPrefix)
-			} else {
-				if printFiles {
-					info, _ := os.Stat(filepath.Join(path, file.Name()))
-					filesize := strconv.FormatInt(info.Size(), 10)
-					if "0" == filesize {
-						filesize = "empty"
-					} else {
-						filesize += "b"
-					}
-					fmt.Fprintf(out, "%s%s (%s)\n", dirChildPrefix, file.Name(), filesize)
-				}
-			}
+		nodes = append(nodes, node)
+	}
+
+	return
+}
+
+func visibleNodes(nodes []*treeNode, printFiles bool) []*treeNode {
+	if printFiles {
+		return nodes
+	}
+
+	var visible []*treeNode
+	for _, node := range nodes {
+		if node.isDir {
+			visible = append(visible, node)
+		}
+	}
+	return visible
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// markdownEscape backslash-escapes what Markdown would take for emphasis,
+// code, links or html, and a leading list or heading marker. An underscore
+// inside a word is left as is, it does not start emphasis.
+func markdownEscape(s string) string {
+	runes := []rune(s)
+	digits := 0
+	for digits < len(runes) && unicode.IsDigit(runes[digits]) {
+		digits++
+	}
+
+	b := &strings.Builder{}
+	for i, r := range runes {
+		escape := strings.ContainsRune("\\`*[]<>~&", r)
+		switch {
+		case r == '_':
+			escape = i == 0 || i == len(runes)-1 || !isWordRune(runes[i-1]) || !isWordRune(runes[i+1])
+		case i == 0 && (r == '+' || r == '-' || r == '#'):
+			escape = true
+		case i == digits && i > 0 && (r == '.' || r == ')'):
+			escape = true
+		}
+		if escape {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func markdownLabel(n *treeNode) string {
+	if n.isDir {
+		return markdownEscape(n.name)
+	}
+	return markdownEscape(n.name) + " (" + formatSize(n.size) + ")"
+}
+
+func markdownRec(out io.Writer, nodes []*treeNode, printFiles bool, indent string) {
+	for _, node := range visibleNodes(nodes, printFiles) {
+		fmt.Fprintf(out, "%s- %s\n", indent, markdownLabel(node))
+		if node.isDir {
+			markdownRec(out, node.children, printFiles, indent+"  ")
 		}
 	}
+}
+
+func markdownTree(out io.Writer, path string, nodes []*treeNode, printFiles bool) {
+	markdownRec(out, nodes, printFiles, "")
+}
 
+func dirTreeMarkdown(out io.Writer, path string, printFiles bool) (ferr error) {
+	nodes, ferr := readTree(path)
+	if ferr != nil {
+		return
+	}
+
+	markdownTree(out, path, nodes, printFiles)
 	return
 }
 
-func dirTree(out io.Writer, path string, printFiles bool) (ferr error) {
-	ferr = dirTreeRec(out, path, printFiles, "")
+// dotQuote makes a DOT string, which knows only the \" and \\ escapes.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func dotNode(out io.Writer, id, label, shape string) {
+	fmt.Fprintf(out, "\t%s [label=%s, shape=%s];\n", dotQuote(id), dotQuote(label), shape)
+}
+
+func dotRec(out io.Writer, parentId string, nodes []*treeNode, printFiles bool) {
+	for _, node := range visibleNodes(nodes, printFiles) {
+		id := filepath.ToSlash(node.path)
+		if node.isDir {
+			dotNode(out, id, node.label(), "folder")
+		} else {
+			dotNode(out, id, node.label(), "note")
+		}
+		fmt.Fprintf(out, "\t%s -> %s;\n", dotQuote(parentId), dotQuote(id))
+
+		if node.isDir {
+			dotRec(out, id, node.children, printFiles)
+		}
+	}
+}
+
+func dotTree(out io.Writer, path string, nodes []*treeNode, printFiles bool) {
+	rootId := filepath.ToSlash(filepath.Clean(path))
+
+	fmt.Fprintln(out, "digraph tree {")
+	dotNode(out, rootId, filepath.Base(path), "folder")
+	dotRec(out, rootId, nodes, printFiles)
+	fmt.Fprintln(out, "}")
+}
+
+func dirTreeDot(out io.Writer, path string, printFiles bool) (ferr error) {
+	nodes, ferr := readTree(path)
+	if ferr != nil {
+		return
+	}
+
+	dotTree(out, path, nodes, printFiles)
 	return
 }
 
+const duBarWidth = 10
+
+func duBar(size, parentSize int64) (percent float64, bar string) {
+	filled := 0
+	if parentSize > 0 {
+		percent = float64(size) * 100 / float64(parentSize)
+		filled = int((size*duBarWidth + parentSize/2) / parentSize)
+	}
+	bar = "[" + strings.Repeat("#", filled) + strings.Repeat(".", duBarWidth-filled) + "]"
+	return
+}
+
+func sortBySize(nodes []*treeNode) []*treeNode {
+	sorted := append([]*treeNode(nil), nodes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].size != sorted[j].size {
+			return sorted[i].size > sorted[j].size
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	return sorted
+}
+
+func duRec(out io.Writer, nodes []*treeNode, parentSize int64, printFiles bool, topN int, dirPrefix string) {
+	shown := sortBySize(visibleNodes(nodes, printFiles))
+
+	var rest []*treeNode
+	if topN > 0 && len(shown) > topN {
+		shown, rest = shown[:topN], shown[topN:]
+	}
+
+	dirChildPrefix := dirPrefix + "├───"
+	childDirPrefix := dirPrefix + "│\t"
+
+	for i, node := range shown {
+		if i == len(shown)-1 && len(rest) == 0 {
+			dirChildPrefix = dirPrefix + "└───"
+			childDirPrefix = dirPrefix + "\t"
+		}
+
+		percent, bar := duBar(node.size, parentSize)
+		fmt.Fprintf(out, "%s%s (%s, %.1f%%) %s\n", dirChildPrefix, node.name, formatSize(node.size), percent, bar)
+
+		if node.isDir {
+			duRec(out, node.children, node.size, printFiles, topN, childDirPrefix)
+		}
+	}
+
+	if len(rest) > 0 {
+		var restSize int64
+		for _, node := range rest {
+			restSize += node.size
+		}
+
+		percent, bar := duBar(restSize, parentSize)
+		fmt.Fprintf(out, "%s└───%d more (%s, %.1f%%) %s\n", dirPrefix, len(rest), formatSize(restSize), percent, bar)
+	}
+}
+
+// dirTreeDu prints the tree like du: every entry carries its aggregated size
+// and share of the parent, heaviest first. topN <= 0 prints every entry.
+func dirTreeDu(out io.Writer, path string, printFiles bool, topN int) (ferr error) {
+	nodes, ferr := readTree(path)
+	if ferr != nil {
+		return
+	}
+
+	var total int64
+	for _, node := range nodes {
+		total += node.size
+	}
+
+	duRec(out, nodes, total, printFiles, topN, "")
+	return
+}
+
+// treeFilter holds find-like predicates. Zero values disable a predicate,
+// maxSize is checked only with hasMax, since zero is a valid bound there.
+type treeFilter struct {
+	minSize  int64
+	maxSize  int64
+	hasMax   bool
+	after    time.Time
+	before   time.Time
+	fileType byte // 'f', 'd', 'l', 'p' or 's'
+	name     *regexp.Regexp
+}
+
+func (f *treeFilter) matchType(node *treeNode) bool {
+	switch f.fileType {
+	case 0:
+		return !node.isDir
+	case 'f':
+		return node.mode.IsRegular()
+	case 'd':
+		return node.isDir
+	case 'l':
+		return node.mode&os.ModeSymlink != 0
+	case 'p':
+		return node.mode&os.ModeNamedPipe != 0
+	case 's':
+		return node.mode&os.ModeSocket != 0
+	}
+	return false
+}
+
+func (f *treeFilter) match(node *treeNode) bool {
+	if !f.matchType(node) {
+		return false
+	}
+	if node.size < f.minSize || (f.hasMax && node.size > f.maxSize) {
+		return false
+	}
+	if !f.after.IsZero() && !node.modTime.After(f.after) {
+		return false
+	}
+	if !f.before.IsZero() && !node.modTime.Before(f.before) {
+		return false
+	}
+	if f.name != nil && !f.name.MatchString(node.name) {
+		return false
+	}
+	return true
+}
+
+// filterTree returns the matching entries together with the directories
+// leading to them.
+func filterTree(nodes []*treeNode, f *treeFilter) []*treeNode {
+	var kept []*treeNode
+	for _, node := range nodes {
+		if !node.isDir {
+			if f.match(node) {
+				kept = append(kept, node)
+			}
+			continue
+		}
+
+		children := filterTree(node.children, f)
+		if len(children) > 0 || f.match(node) {
+			pruned := *node
+			pruned.children = children
+			kept = append(kept, &pruned)
+		}
+	}
+	return kept
+}
+
+func dirTreeFind(out io.Writer, path string, printFiles bool, f *treeFilter) (ferr error) {
+	nodes, ferr := readTree(path)
+	if ferr != nil {
+		return
+	}
+
+	dirTreeRec(out, filterTree(nodes, f), printFiles, "")
+	return
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+const usage = "usage go run main.go . [-f] [-md|-dot] " +
+	"[-size-min N] [-size-max N] [-newer DATE] [-older DATE] [-type f|d|l|p|s] [-name REGEXP]\n" +
+	"   or go run main.go . [-f] -du [-top N]"
+
 func main() {
 	out := os.Stdout
-	if !(len(os.Args) == 2 || len(os.Args) == 3) {
-		panic("usage go run main.go . [-f]")
+	if len(os.Args) < 2 {
+		panic(usage)
 	}
 	path := os.Args[1]
-	printFiles := len(os.Args) == 3 && os.Args[2] == "-f"
-	err := dirTree(out, path, printFiles)
+
+	printFiles := false
+	du := false
+	topN := 0
+	top := false
+	render := func(out io.Writer, path string, nodes []*treeNode, printFiles bool) {
+		dirTreeRec(out, nodes, printFiles, "")
+	}
+	format := ""
+	setFormat := func(name string, r func(io.Writer, string, []*treeNode, bool)) {
+		if format != "" && format != name {
+			panic(usage)
+		}
+		format = name
+		render = r
+	}
+	filter := &treeFilter{}
+	filtered := false
+	args := os.Args[2:]
+	next := func(i *int) string {
+		*i++
+		if *i == len(args) {
+			panic(usage)
+		}
+		return args[*i]
+	}
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "-f":
+			printFiles = true
+		case "-md":
+			setFormat("md", markdownTree)
+		case "-dot":
+			setFormat("dot", dotTree)
+		case "-du":
+			du = true
+		case "-top":
+			topN, err = strconv.Atoi(next(&i))
+			top = true
+		case "-size-min":
+			filter.minSize, err = strconv.ParseInt(next(&i), 10, 64)
+			filtered = true
+		case "-size-max":
+			filter.maxSize, err = strconv.ParseInt(next(&i), 10, 64)
+			filter.hasMax = true
+			filtered = true
+		case "-newer":
+			filter.after, err = parseDate(next(&i))
+			filtered = true
+		case "-older":
+			filter.before, err = parseDate(next(&i))
+			filtered = true
+		case "-type":
+			fileType := next(&i)
+			if len(fileType) != 1 || !strings.Contains("fdlps", fileType) {
+				panic(usage)
+			}
+			filter.fileType = fileType[0]
+			filtered = true
+		case "-name":
+			filter.name, err = regexp.Compile(next(&i))
+			filtered = true
+		default:
+			panic(usage)
+		}
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
+	// du sizes are of whole directories, so it does not go with filters
+	if du {
+		if format != "" || filtered {
+			panic(usage)
+		}
+		if err := dirTreeDu(out, path, printFiles, topN); err != nil {
+			panic(err.Error())
+		}
+		return
+	}
+	// -top ranks du sizes only
+	if top {
+		panic(usage)
+	}
+
+	nodes, err := readTree(path)
 	if err != nil {
 		panic(err.Error())
 	}
+	if filtered {
+		nodes = filterTree(nodes, filter)
+	}
+	render(out, path, nodes, printFiles)
 }
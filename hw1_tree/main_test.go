@@ -2,7 +2,12 @@ package main
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 )
 
 const testFullResult = `├───project
@@ -73,3 +78,318 @@ func TestTreeDir(t *testing.T) {
 		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDirResult)
 	}
 }
+
+const testMarkdownResult = `- project
+  - file.txt (19b)
+  - gopher.png (70372b)
+- static
+  - a_lorem
+    - dolor.txt (empty)
+    - gopher.png (70372b)
+    - ipsum
+      - gopher.png (70372b)
+  - css
+    - body.css (28b)
+  - empty.txt (empty)
+  - html
+    - index.html (57b)
+  - js
+    - site.js (10b)
+  - z_lorem
+    - dolor.txt (empty)
+    - gopher.png (70372b)
+    - ipsum
+      - gopher.png (70372b)
+- zline
+  - empty.txt (empty)
+  - lorem
+    - dolor.txt (empty)
+    - gopher.png (70372b)
+    - ipsum
+      - gopher.png (70372b)
+- zzfile.txt (empty)
+`
+
+func TestTreeMarkdown(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeMarkdown(out, "testdata", true)
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testMarkdownResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testMarkdownResult)
+	}
+}
+
+const testDotDirResult = `digraph tree {
+	"testdata" [label="testdata", shape=folder];
+	"testdata/project" [label="project", shape=folder];
+	"testdata" -> "testdata/project";
+	"testdata/static" [label="static", shape=folder];
+	"testdata" -> "testdata/static";
+	"testdata/static/a_lorem" [label="a_lorem", shape=folder];
+	"testdata/static" -> "testdata/static/a_lorem";
+	"testdata/static/a_lorem/ipsum" [label="ipsum", shape=folder];
+	"testdata/static/a_lorem" -> "testdata/static/a_lorem/ipsum";
+	"testdata/static/css" [label="css", shape=folder];
+	"testdata/static" -> "testdata/static/css";
+	"testdata/static/html" [label="html", shape=folder];
+	"testdata/static" -> "testdata/static/html";
+	"testdata/static/js" [label="js", shape=folder];
+	"testdata/static" -> "testdata/static/js";
+	"testdata/static/z_lorem" [label="z_lorem", shape=folder];
+	"testdata/static" -> "testdata/static/z_lorem";
+	"testdata/static/z_lorem/ipsum" [label="ipsum", shape=folder];
+	"testdata/static/z_lorem" -> "testdata/static/z_lorem/ipsum";
+	"testdata/zline" [label="zline", shape=folder];
+	"testdata" -> "testdata/zline";
+	"testdata/zline/lorem" [label="lorem", shape=folder];
+	"testdata/zline" -> "testdata/zline/lorem";
+	"testdata/zline/lorem/ipsum" [label="ipsum", shape=folder];
+	"testdata/zline/lorem" -> "testdata/zline/lorem/ipsum";
+}
+`
+
+func TestTreeDotDir(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeDot(out, "testdata", false)
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testDotDirResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDotDirResult)
+	}
+}
+
+const testDuTopResult = `├───static (281583b, 57.1%) [######....]
+│	├───a_lorem (140744b, 50.0%) [#####.....]
+│	│	└───ipsum (70372b, 50.0%) [#####.....]
+│	├───z_lorem (140744b, 50.0%) [#####.....]
+│	│	└───ipsum (70372b, 50.0%) [#####.....]
+│	└───3 more (95b, 0.0%) [..........]
+├───zline (140744b, 28.6%) [###.......]
+│	└───lorem (140744b, 100.0%) [##########]
+│		└───ipsum (70372b, 50.0%) [#####.....]
+└───1 more (70391b, 14.3%) [#.........]
+`
+
+func TestTreeDuTop(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeDu(out, "testdata", false, 2)
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testDuTopResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDuTopResult)
+	}
+}
+
+const testFindResult = `├───project
+│	└───file.txt (19b)
+└───static
+	├───css
+	│	└───body.css (28b)
+	└───js
+		└───site.js (10b)
+`
+
+func TestTreeFind(t *testing.T) {
+	out := new(bytes.Buffer)
+	filter := &treeFilter{
+		minSize:  1,
+		maxSize:  30,
+		hasMax:   true,
+		fileType: 'f',
+		name:     regexp.MustCompile(`\.(txt|css|js)$`),
+	}
+	err := dirTreeFind(out, "testdata", true, filter)
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testFindResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testFindResult)
+	}
+}
+
+const testFindModTimeResult = `└───new
+	└───b.txt (empty)
+`
+
+func TestTreeFindModTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	files := map[string]time.Time{
+		"a.txt":     now.Add(-48 * time.Hour),
+		"new/b.txt": now,
+		"old/c.txt": now.Add(-48 * time.Hour),
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	err = dirTreeFind(out, dir, true, &treeFilter{after: now.Add(-time.Hour)})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testFindModTimeResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testFindModTimeResult)
+	}
+}
+
+const testSymlinkResult = `├───data.txt (1000b)
+└───link (1000b)
+`
+
+func TestTreeSymlinkSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "data.txt"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("data.txt", filepath.Join(dir, "link")); err != nil {
+		t.Skip("symlinks are not supported: ", err)
+	}
+
+	out := new(bytes.Buffer)
+	err = dirTree(out, dir, true)
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testSymlinkResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testSymlinkResult)
+	}
+}
+
+const testUnreadableResult = `├───closed
+└───open
+	└───file.txt (3b)
+`
+
+func TestTreeUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root reads any directory")
+	}
+
+	dir, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	closed := filepath.Join(dir, "closed")
+	for _, sub := range []string{closed, filepath.Join(dir, "open")} {
+		if err := os.Mkdir(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(sub, "file.txt"), []byte("abc"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(closed, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(closed, 0755)
+
+	// нечитаемая папка печатается без содержимого, остальное дерево на месте
+	out := new(bytes.Buffer)
+	err = dirTree(out, dir, true)
+	if err != nil {
+		t.Errorf("test for OK Failed - error %v", err)
+	}
+	result := out.String()
+	if result != testUnreadableResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testUnreadableResult)
+	}
+}
+
+const testMarkdownEscapeResult = "- \\#tag (empty)\n" +
+	"- \\-dash (empty)\n" +
+	"- 1\\. one (empty)\n" +
+	"- \\[x\\](y) (empty)\n" +
+	"- \\_\\_init\\_\\_.py (empty)\n" +
+	"- a_b.txt (empty)\n" +
+	"- \\*star\\* \\`code\\` (empty)\n"
+
+const testDotEscapeResult = "digraph tree {\n" +
+	"\t\"dir\" [label=\"dir\", shape=folder];\n" +
+	"\t\"dir/q\\\"b\\\\s\" [label=\"q\\\"b\\\\s (empty)\", shape=note];\n" +
+	"\t\"dir\" -> \"dir/q\\\"b\\\\s\";\n" +
+	"\t\"dir/tab\tname\" [label=\"tab\tname (empty)\", shape=note];\n" +
+	"\t\"dir\" -> \"dir/tab\tname\";\n" +
+	"}\n"
+
+func TestTreeEscape(t *testing.T) {
+	nodes := func(names ...string) []*treeNode {
+		var nodes []*treeNode
+		for _, name := range names {
+			nodes = append(nodes, &treeNode{name: name, path: "dir/" + name})
+		}
+		return nodes
+	}
+
+	// имена не должны превращаться в разметку
+	out := new(bytes.Buffer)
+	markdownTree(out, "dir", nodes("#tag", "-dash", "1. one", "[x](y)", "__init__.py", "a_b.txt", "*star* `code`"), true)
+	if result := out.String(); result != testMarkdownEscapeResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testMarkdownEscapeResult)
+	}
+
+	// в DOT экранируются только кавычка и обратная косая черта
+	out = new(bytes.Buffer)
+	dotTree(out, "dir", nodes(`q"b\s`, "tab\tname"), true)
+	if result := out.String(); result != testDotEscapeResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDotEscapeResult)
+	}
+}
+
+const testFindEmptyResult = `├───static
+│	├───a_lorem
+│	│	└───dolor.txt (empty)
+│	├───empty.txt (empty)
+│	└───z_lorem
+│		└───dolor.txt (empty)
+├───zline
+│	├───empty.txt (empty)
+│	└───lorem
+│		└───dolor.txt (empty)
+└───zzfile.txt (empty)
+`
+
+func TestTreeFindEmpty(t *testing.T) {
+	out := new(bytes.Buffer)
+	// нулевой -size-max ищет пустые файлы, а не снимает ограничение
+	filter := &treeFilter{maxSize: 0, hasMax: true}
+	err := dirTreeFind(out, "testdata", true, filter)
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testFindEmptyResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testFindEmptyResult)
+	}
+}
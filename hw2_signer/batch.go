@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Batcher groups values into []interface{} batches of at most Size items. A
+// batch is also sent Latency after its first item, so a slow input does not
+// hold values back. With neither set every value is a batch of its own.
+type Batcher struct {
+	Size    int
+	Latency time.Duration
+	// Clock times the Latency, SignerClock when nil
+	Clock Clock
+}
+
+func (b Batcher) Batch(in, out chan interface{}) {
+	mustCtxJob(b.Job())(in, out)
+}
+
+func (b Batcher) Job() ctxJob {
+	size := b.Size
+	if size <= 0 && b.Latency <= 0 {
+		size = 1
+	}
+
+	return func(ctx context.Context, in, out chan interface{}) error {
+		var batch []interface{}
+
+		add := func(v interface{}) error {
+			batch = append(batch, v)
+			return nil
+		}
+		flush := func() error {
+			res := batch
+			batch = nil
+			return send(ctx, out, res)
+		}
+
+		return runWindows(ctx, clockOr(b.Clock), in, size, b.Latency, add, flush)
+	}
+}
+
+// Unbatch sends the values of every Batcher batch one by one.
+func Unbatch(in, out chan interface{}) {
+	mustCtxJob(UnbatchJob)(in, out)
+}
+
+func UnbatchJob(ctx context.Context, in, out chan interface{}) error {
+	for {
+		v, ok := recv(ctx, in, nil)
+		if !ok {
+			return ctx.Err()
+		}
+		batch, ok := v.([]interface{})
+		if !ok {
+			return unexpectedInput("Unbatch", v)
+		}
+		for _, item := range batch {
+			if err := send(ctx, out, item); err != nil {
+				return err
+			}
+		}
+	}
+}
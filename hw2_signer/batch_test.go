@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func runBatcher(t *testing.T, b Batcher, pause time.Duration, groups ...[]int) [][]interface{} {
+	var result [][]interface{}
+	err := ExecutePipelineCtx(context.Background(),
+		groupSource(pause, groups...),
+		b.Job(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for v := range in {
+				result = append(result, v.([]interface{}))
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return result
+}
+
+func TestBatcherSize(t *testing.T) {
+	t.Parallel()
+
+	result := runBatcher(t, Batcher{Size: 2}, 0, []int{1, 2, 3, 4, 5})
+	expected := [][]interface{}{{1, 2}, {3, 4}, {5}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestBatcherLatency(t *testing.T) {
+	t.Parallel()
+
+	// между группами пауза дольше задержки
+	result := runBatcher(t, Batcher{Size: 10, Latency: 20 * time.Millisecond}, 50*time.Millisecond,
+		[]int{1, 2}, []int{3}, []int{4, 5})
+	expected := [][]interface{}{{1, 2}, {3}, {4, 5}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+// TestPipeline с батчами посередине: значения все так же идут без накопления
+func TestBatcherFreeFlow(t *testing.T) {
+	t.Parallel()
+
+	var ok = true
+	var recieved uint32
+	freeFlowJobs := []job{
+		job(func(in, out chan interface{}) {
+			out <- 1
+			time.Sleep(50 * time.Millisecond)
+			if atomic.LoadUint32(&recieved) == 0 {
+				ok = false
+			}
+			out <- 2
+			out <- 3
+		}),
+		job(Batcher{Size: 100, Latency: 5 * time.Millisecond}.Batch),
+		job(Unbatch),
+		job(func(in, out chan interface{}) {
+			for range in {
+				atomic.AddUint32(&recieved, 1)
+			}
+		}),
+	}
+	ExecutePipeline(freeFlowJobs...)
+	if !ok || recieved != 3 {
+		t.Errorf("no value free flow - dont collect them, recieved = %d", recieved)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+var ErrCheckpointSigner = errors.New("checkpoint is made by another signer")
+
+// checkpointHeader is the first line of a checkpoint file.
+type checkpointHeader struct {
+	Signer string `json:"signer"`
+}
+
+type checkpointKey struct {
+	Stage string `json:"stage"`
+	Salt  string `json:"salt"`
+	Input string `json:"input"`
+}
+
+type checkpointRecord struct {
+	checkpointKey
+	Result string `json:"result"`
+}
+
+// Checkpoint keeps finished hashes in a file, a JSON record per line, so a
+// run started again skips them. The records are keyed by the stage, the input
+// and the salt. The first line names the signer the hashes are made by, and
+// the file cannot be opened for another one.
+type Checkpoint struct {
+	mu      sync.Mutex
+	f       *os.File
+	results map[checkpointKey]string
+}
+
+// OpenCheckpoint loads the records of path, creating it for signer if
+// needed. signer names the hash backend, a file made for another name is
+// refused with ErrCheckpointSigner. A last line cut by a crash is dropped.
+func OpenCheckpoint(path, signer string) (*Checkpoint, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{f: f, results: map[checkpointKey]string{}}
+	if err := c.load(signer); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Checkpoint) load(signer string) error {
+	r := bufio.NewReader(c.f)
+
+	line, err := r.ReadBytes('\n')
+	if err == io.EOF {
+		// a new file, or a header cut by a crash
+		return c.writeHeader(signer)
+	}
+	if err != nil {
+		return err
+	}
+	header := checkpointHeader{}
+	if err := json.Unmarshal(bytes.TrimSpace(line), &header); err != nil || header.Signer == "" {
+		return fmt.Errorf("bad header %q", bytes.TrimSpace(line))
+	}
+	if header.Signer != signer {
+		return fmt.Errorf("%w: %s, not %s", ErrCheckpointSigner, header.Signer, signer)
+	}
+
+	good := int64(len(line))
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rec := checkpointRecord{}
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return fmt.Errorf("bad record at offset %d: %w", good, err)
+		}
+		c.results[rec.checkpointKey] = rec.Result
+		good += int64(len(line))
+	}
+
+	if err := c.f.Truncate(good); err != nil {
+		return err
+	}
+	_, err = c.f.Seek(good, io.SeekStart)
+	return err
+}
+
+func (c *Checkpoint) writeHeader(signer string) error {
+	line, err := json.Marshal(checkpointHeader{Signer: signer})
+	if err != nil {
+		return err
+	}
+	if err := c.f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = c.f.WriteAt(append(line, '\n'), 0)
+	if err != nil {
+		return err
+	}
+	_, err = c.f.Seek(int64(len(line))+1, io.SeekStart)
+	return err
+}
+
+// Get returns the result saved for input of stage with salt.
+func (c *Checkpoint) Get(stage, salt, input string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res, ok := c.results[checkpointKey{Stage: stage, Salt: salt, Input: input}]
+	return res, ok
+}
+
+func (c *Checkpoint) Put(stage, salt, input, result string) error {
+	rec := checkpointRecord{
+		checkpointKey: checkpointKey{Stage: stage, Salt: salt, Input: input},
+		Result:        result,
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.results[rec.checkpointKey]; ok {
+		return nil
+	}
+	if _, err := c.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	c.results[rec.checkpointKey] = result
+	return nil
+}
+
+// Len is the number of saved results.
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.results)
+}
+
+func (c *Checkpoint) Close() error {
+	return c.f.Close()
+}
+
+// checkpointed returns the saved result of stage for data, or computes it
+// with fn and saves it. Without a Checkpoint it just calls fn.
+func (h *Hasher) checkpointed(stage, data string, fn func(string) string) (string, error) {
+	if h.Checkpoint == nil {
+		return fn(data), nil
+	}
+
+	salt := h.salt()
+	if res, ok := h.Checkpoint.Get(stage, salt, data); ok {
+		return res, nil
+	}
+	res := fn(data)
+	return res, h.Checkpoint.Put(stage, salt, data, res)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// killingSigner отменяет контекст пайплайна после limit вызовов Crc32
+type killingSigner struct {
+	FastSigner
+	calls  uint32
+	limit  uint32
+	cancel context.CancelFunc
+}
+
+func (s *killingSigner) Crc32(data string) string {
+	if atomic.AddUint32(&s.calls, 1) == s.limit {
+		s.cancel()
+	}
+	return s.FastSigner.Crc32(data)
+}
+
+func TestCheckpointResume(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	values := make([]int, 20)
+	for i := range values {
+		values[i] = i * 7
+	}
+
+	expected, err := signValues(context.Background(), &Hasher{Signer: FastSigner{}}, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// первый запуск обрывается на середине
+	c, err := OpenCheckpoint(path, "fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = signValues(ctx, &Hasher{Signer: &killingSigner{limit: 60, cancel: cancel}, Checkpoint: c}, values)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the run to be cancelled, got %v", err)
+	}
+	saved := c.Len()
+	c.Close()
+	if saved == 0 {
+		t.Fatal("nothing was checkpointed")
+	}
+
+	// запись, оборванная падением процесса
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"stage":"SingleHash","sa`)
+	f.Close()
+
+	c, err = OpenCheckpoint(path, "fast")
+	if err != nil {
+		t.Fatalf("cant reopen checkpoint: %v", err)
+	}
+	defer c.Close()
+	if c.Len() != saved {
+		t.Errorf("checkpoint has %d results after reopen, expected %d", c.Len(), saved)
+	}
+
+	signer := &countingSigner{Signer: FastSigner{}}
+	res, err := signValues(context.Background(), &Hasher{Signer: signer, Checkpoint: c}, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.Result != expected.Result {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res.Result, expected.Result)
+	}
+	// полный прогон это 2+6 вызовов Crc32 на значение
+	if full := uint32(len(values) * 8); signer.crc32Calls >= full {
+		t.Errorf("finished items were hashed again: %d crc32 calls of %d", signer.crc32Calls, full)
+	}
+}
+
+func TestCheckpointSigner(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	c, err := OpenCheckpoint(path, "fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put("SingleHash", "", "0", "result")
+	c.Close()
+
+	// хеши другого бэкенда в подпись не попадают
+	if _, err := OpenCheckpoint(path, "sha256"); !errors.Is(err, ErrCheckpointSigner) {
+		t.Errorf("expected ErrCheckpointSigner, got %v", err)
+	}
+
+	c, err = OpenCheckpoint(path, "fast")
+	if err != nil {
+		t.Fatalf("cant reopen checkpoint: %v", err)
+	}
+	defer c.Close()
+	if res, ok := c.Get("SingleHash", "", "0"); !ok || res != "result" {
+		t.Errorf("result lost after reopen: %q", res)
+	}
+}
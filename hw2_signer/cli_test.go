@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCLI(t *testing.T) {
+	// значения из hw2.md
+	testExpected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	err := run([]string{"-json", "-trace", "-signer", "fast"}, strings.NewReader("0\n\n1\n"), stdout, stderr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res := cliResult{}
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("cant unpack result json: %v", err)
+	}
+	if res.Result != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res.Result, testExpected)
+	}
+	if len(res.Items) != 2 || res.Items[1].SingleHash != "2212294583~709660146" {
+		t.Errorf("unexpected items %+v", res.Items)
+	}
+
+	for _, line := range []string{
+		"0 SingleHash md5(data) cfcd208495d565ef66e7dff9f98764da",
+		"4108050209~502633748 MultiHash: crc32(th+step1)) 3 3407918797",
+		"CombineResults " + testExpected,
+	} {
+		if !strings.Contains(stderr.String(), line+"\n") {
+			t.Errorf("trace line %q not found in\n%s", line, stderr)
+		}
+	}
+}
+
+func TestCLIBadInput(t *testing.T) {
+	err := run(nil, strings.NewReader("1\nx\n"), new(bytes.Buffer), new(bytes.Buffer))
+	if err == nil {
+		t.Errorf("expected an error for a bad line")
+	}
+}
+
+func TestCLIMemo(t *testing.T) {
+	input := "1\n2\n1\n1\n2\n"
+
+	expected := new(bytes.Buffer)
+	if err := run([]string{"-signer", "fast"}, strings.NewReader(input), expected, new(bytes.Buffer)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	counter := &countingSigner{Signer: FastSigner{}}
+	RegisterSigner("counting", func(string) Signer {
+		return counter
+	})
+	t.Cleanup(func() {
+		signersMu.Lock()
+		defer signersMu.Unlock()
+		delete(signers, "counting")
+	})
+
+	// повторы берутся из памяти, подпись та же
+	stdout := new(bytes.Buffer)
+	if err := run([]string{"-signer", "counting", "-memo", "100"}, strings.NewReader(input), stdout, new(bytes.Buffer)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != expected.String() {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", stdout, expected)
+	}
+	// по 8 вызовов crc32 на каждое уникальное значение
+	if counter.crc32Calls != 2*8 {
+		t.Errorf("duplicates were computed again\nGot: %d\nExpected: %d", counter.crc32Calls, 2*8)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "time"
+
+// Clock is the time source of the Md5 scheduler, the combining windows and
+// the hashing traces. ClockedSigner, WindowCombiner and Batcher take one, so
+// tests can run them on a virtual clock without waiting.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	// After sends the time to the channel once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+var SignerClock Clock = realClock{}
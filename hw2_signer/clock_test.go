@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeSleeper struct {
+	deadline time.Time
+	wake     chan time.Time
+}
+
+// FakeClock это виртуальное время: Sleep и After ждут, пока часы не переведут
+// через Advance или AdvanceIdle
+type FakeClock struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	now      time.Time
+	sleepers []*fakeSleeper
+}
+
+func NewFakeClock() *FakeClock {
+	c := &FakeClock{now: time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &fakeSleeper{deadline: c.now.Add(d), wake: make(chan time.Time, 1)}
+	if d <= 0 {
+		s.wake <- c.now
+		return s.wake
+	}
+	c.sleepers = append(c.sleepers, s)
+	c.cond.Broadcast()
+	return s.wake
+}
+
+// Advance переводит часы на d и будит тех, чей срок прошел
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advanceTo(c.now.Add(d))
+}
+
+func (c *FakeClock) advanceTo(t time.Time) {
+	c.now = t
+
+	sleepers := c.sleepers[:0]
+	for _, s := range c.sleepers {
+		if s.deadline.After(t) {
+			sleepers = append(sleepers, s)
+			continue
+		}
+		s.wake <- t
+	}
+	c.sleepers = sleepers
+}
+
+// сколько реального времени ждать спящих горутин, прежде чем сдаться
+const fakeClockTimeout = 5 * time.Second
+
+// WaitSleepers ждет, пока не уснут ровно n горутин, и возвращает false, если
+// за fakeClockTimeout этого не случилось
+func (c *FakeClock) WaitSleepers(n int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.waitSleepers(n)
+}
+
+func (c *FakeClock) waitSleepers(n int) bool {
+	expired := false
+	timer := time.AfterFunc(fakeClockTimeout, func() {
+		c.mu.Lock()
+		expired = true
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	for len(c.sleepers) != n && !expired {
+		c.cond.Wait()
+	}
+	return len(c.sleepers) == n
+}
+
+// AdvanceIdle ждет, пока не останется ни одной работающей горутины, кроме
+// вызвавшей, и переводит часы к ближайшему сроку. Возвращает false, если
+// спящих нет или горутины так и не остановились за fakeClockTimeout.
+// Разбудить остальных тогда могут только часы, так что время в тесте не
+// зависит от того, сколько горутин и в каком порядке уснули. Быстро
+// получается на одном процессоре, см. oneProc.
+func (c *FakeClock) AdvanceIdle() bool {
+	deadline := time.Now().Add(fakeClockTimeout)
+	buf := make([]byte, 64<<10)
+	for running(&buf) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		runtime.Gosched()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.sleepers) == 0 {
+		return false
+	}
+	next := c.sleepers[0].deadline
+	for _, s := range c.sleepers[1:] {
+		if s.deadline.Before(next) {
+			next = s.deadline
+		}
+	}
+	c.advanceTo(next)
+	return true
+}
+
+// running считает горутины, которые работают или готовы работать, кроме
+// вызвавшей. На одном процессоре это точно знают счетчики планировщика: пока
+// работает вызвавшая, его очередь никто не трогает. Иначе, и в Go до 1.26
+// без этих счетчиков, состояния берутся из runtime.Stack, которая
+// останавливает все горутины, так что состояния согласованы.
+func running(buf *[]byte) int {
+	if runtime.GOMAXPROCS(0) == 1 {
+		samples := []metrics.Sample{
+			{Name: "/sched/goroutines/runnable:goroutines"},
+			{Name: "/sched/goroutines/not-in-go:goroutines"},
+		}
+		metrics.Read(samples)
+		if samples[0].Value.Kind() == metrics.KindUint64 && samples[1].Value.Kind() == metrics.KindUint64 {
+			return int(samples[0].Value.Uint64() + samples[1].Value.Uint64())
+		}
+	}
+
+	n := runtime.Stack(*buf, true)
+	for n == len(*buf) {
+		*buf = make([]byte, 2*len(*buf))
+		n = runtime.Stack(*buf, true)
+	}
+
+	count := 0
+	// первой идет вызвавшая горутина
+	for i, header := range bytes.Split((*buf)[:n], []byte("\n\n")) {
+		if i == 0 {
+			continue
+		}
+		line := string(header[:bytes.IndexByte(append(header, '\n'), '\n')])
+		start, end := strings.IndexByte(line, '['), strings.IndexByte(line, ']')
+		if start < 0 || end < start {
+			continue
+		}
+		state := strings.SplitN(line[start+1:end], ",", 2)[0]
+		if state == "running" || state == "runnable" || state == "syscall" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock()
+	start := clock.Now()
+
+	var woken uint32
+	wg := &sync.WaitGroup{}
+	for _, d := range []time.Duration{time.Second, 2 * time.Second} {
+		wg.Add(1)
+		go func(d time.Duration) {
+			defer wg.Done()
+			clock.Sleep(d)
+			atomic.AddUint32(&woken, 1)
+		}(d)
+	}
+
+	if !clock.WaitSleepers(2) {
+		t.Fatal("goroutines do not fall asleep")
+	}
+	clock.Advance(1500 * time.Millisecond)
+	for atomic.LoadUint32(&woken) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	wg.Wait()
+
+	if elapsed := clock.Now().Sub(start); elapsed != 2*time.Second {
+		t.Errorf("wrong virtual time\nGot: %s\nExpected: %s", elapsed, 2*time.Second)
+	}
+}
+
+// oneProc оставляет тесту один процессор, чтобы AdvanceIdle не снимала
+// стеки всех горутин на каждом шаге
+func oneProc(t *testing.T) {
+	prev := runtime.GOMAXPROCS(1)
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(prev)
+	})
+}
+
+// runVirtual запускает jobs и ведет часы от срока к сроку, пока они не
+// закончатся
+func runVirtual(t *testing.T, clock *FakeClock, jobs ...job) {
+	t.Helper()
+	oneProc(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ExecutePipeline(jobs...)
+	}()
+
+	deadline := time.Now().Add(fakeClockTimeout)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		// пока часы идут, конвейер жив, сколько бы виртуального времени это ни заняло
+		if clock.AdvanceIdle() {
+			deadline = time.Now().Add(fakeClockTimeout)
+		} else if time.Now().After(deadline) {
+			t.Fatal("pipeline hangs with no goroutine asleep")
+		}
+	}
+}
+
+// TestSigner на виртуальных часах: время считается точно, а тест идет мгновенно
+func TestSignerVirtualClock(t *testing.T) {
+	clock := NewFakeClock()
+	signer := &ClockedSigner{Clock: clock}
+	t.Cleanup(signer.Close)
+	h := &Hasher{Signer: signer}
+
+	testExpected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+	testResult := "NOT_SET"
+
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+
+	hashSignJobs := []job{
+		job(func(in, out chan interface{}) {
+			for _, fibNum := range inputData {
+				out <- fibNum
+			}
+		}),
+		job(h.SingleHash),
+		job(h.MultiHash),
+		job(h.CombineResults),
+		job(func(in, out chan interface{}) {
+			testResult = (<-in).(string)
+		}),
+	}
+
+	start := clock.Now()
+	runVirtual(t, clock, hashSignJobs...)
+	end := clock.Now().Sub(start)
+
+	if testExpected != testResult {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
+	}
+
+	// md5 идут по очереди по 10ms, дальше две секунды crc32:
+	// последний SingleHash готов через 70ms + 1s, его MultiHash еще через 1s
+	expectedTime := 2070 * time.Millisecond
+	if end != expectedTime {
+		t.Errorf("wrong virtual time\nGot: %s\nExpected: %s", end, expectedTime)
+	}
+}
+
+// hw2.md обещает до 100 входов: виртуальных секунд больше, чем fakeClockTimeout
+// реальных, и тест все равно идет мгновенно
+func TestSignerVirtualClockMaxInput(t *testing.T) {
+	clock := NewFakeClock()
+	signer := &ClockedSigner{Clock: clock}
+	t.Cleanup(signer.Close)
+	h := &Hasher{Signer: signer}
+	fast := &Hasher{Signer: FastSigner{}}
+
+	var expected []string
+	for i := 0; i < MaxInputDataLen; i++ {
+		expected = append(expected, fast.multiHash(fast.singleHash(strconv.Itoa(i))))
+	}
+	sort.Strings(expected)
+	testExpected := strings.Join(expected, "_")
+	testResult := "NOT_SET"
+
+	start := clock.Now()
+	runVirtual(t, clock,
+		job(func(in, out chan interface{}) {
+			for i := 0; i < MaxInputDataLen; i++ {
+				out <- i
+			}
+		}),
+		job(h.SingleHash),
+		job(h.MultiHash),
+		job(h.CombineResults),
+		job(func(in, out chan interface{}) {
+			testResult = (<-in).(string)
+		}),
+	)
+	end := clock.Now().Sub(start)
+
+	if testExpected != testResult {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
+	}
+	// все md5 по очереди, потом crc32(md5) последнего и его MultiHash
+	if expectedTime := MaxInputDataLen*Md5Cost + 2*time.Second; end != expectedTime {
+		t.Errorf("wrong virtual time\nGot: %s\nExpected: %s", end, expectedTime)
+	}
+}
+
+func TestClockedSignerOverheat(t *testing.T) {
+	oneProc(t)
+	clock := NewFakeClock()
+	signer := &ClockedSigner{Clock: clock}
+
+	// мимо планировщика два md5 сразу упираются в перегрев
+	wg := &sync.WaitGroup{}
+	results := make([]string, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = signer.md5(strconv.Itoa(i))
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
+	}()
+
+	start := clock.Now()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+			clock.AdvanceIdle()
+		}
+	}
+	end := clock.Now().Sub(start)
+
+	for i, res := range results {
+		if expected := (FastSigner{}).Md5(strconv.Itoa(i)); res != expected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+		}
+	}
+	// второй ждет секунду перегрева и считает свои 10ms
+	if expectedTime := time.Second + Md5Cost; end != expectedTime {
+		t.Errorf("wrong virtual time\nGot: %s\nExpected: %s", end, expectedTime)
+	}
+}
+
+// TestByIlia на виртуальных часах
+func TestByIliaVirtualClock(t *testing.T) {
+	clock := NewFakeClock()
+
+	var recieved uint32
+	freeFlowJobs := []job{
+		job(func(in, out chan interface{}) {
+			out <- uint32(1)
+			out <- uint32(3)
+			out <- uint32(4)
+		}),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				out <- val.(uint32) * 3
+				clock.Sleep(time.Millisecond * 100)
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				atomic.AddUint32(&recieved, val.(uint32))
+			}
+		}),
+	}
+
+	start := clock.Now()
+	runVirtual(t, clock, freeFlowJobs...)
+	end := clock.Now().Sub(start)
+
+	expectedTime := time.Millisecond * 300
+	if end != expectedTime {
+		t.Errorf("wrong virtual time\nGot: %s\nExpected: %s", end, expectedTime)
+	}
+
+	if recieved != (1+3+4)*3 {
+		t.Errorf("f3 have not collected inputs, recieved = %d", recieved)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PipelineConfig describes a chain of registered jobs, as JSON or YAML:
+//
+//	stages:
+//	  - job: SingleHash
+//	    workers: 2
+//	  - job: MultiHash
+//	    buffer: 10
+//	  - job: CombineResults
+type PipelineConfig struct {
+	Stages []StageSpec `json:"stages" yaml:"stages"`
+}
+
+type StageSpec struct {
+	// Name defaults to Job
+	Name string `json:"name" yaml:"name"`
+	Job  string `json:"job" yaml:"job"`
+	// Workers is the pool size of the hash jobs, Hasher.Workers by default.
+	// Registered jobs run in as many copies, and CombineResults jobs, which
+	// give one result for all the values, take no more than one.
+	Workers int `json:"workers" yaml:"workers"`
+	Buffer  int `json:"buffer" yaml:"buffer"`
+	// OnPanic is fail, skip or restart. Only the pool jobs, SingleHash and
+	// MultiHash, can skip a value, other jobs would lose it in a restart.
+	OnPanic     string `json:"on_panic" yaml:"on_panic"`
+	Backoff     string `json:"backoff" yaml:"backoff"`
+	MaxRestarts int    `json:"max_restarts" yaml:"max_restarts"`
+}
+
+var panicPolicies = map[string]int{
+	"":        PolicyFail,
+	"fail":    PolicyFail,
+	"skip":    PolicySkip,
+	"restart": PolicyRestart,
+}
+
+// registeredJob builds the job of a stage. A pool job gets the stage
+// workers as its size, other jobs are copied unless they are single.
+type registeredJob struct {
+	pool   func(h *Hasher, workers int) ctxJob
+	job    func(h *Hasher) ctxJob
+	single bool
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]registeredJob{
+		"SingleHash": {pool: func(h *Hasher, workers int) ctxJob {
+			return WorkerPool(workers, false, h.singleHashItem)
+		}},
+		"SingleHashOrdered": {pool: func(h *Hasher, workers int) ctxJob {
+			return WorkerPool(workers, true, h.singleHashItem)
+		}},
+		"MultiHash": {pool: func(h *Hasher, workers int) ctxJob {
+			return WorkerPool(workers, false, h.multiHashItem)
+		}},
+		"MultiHashOrdered": {pool: func(h *Hasher, workers int) ctxJob {
+			return WorkerPool(workers, true, h.multiHashItem)
+		}},
+		"CombineResults": {single: true, job: func(h *Hasher) ctxJob {
+			return fromErrJob(h.CombineResultsE)
+		}},
+		"CombineResultsArrival": {single: true, job: func(h *Hasher) ctxJob {
+			return fromErrJob(fromJob(CombineResultsArrival))
+		}},
+	}
+)
+
+// RegisterJob makes j available to pipeline configs under name. It panics if
+// the name is taken.
+func RegisterJob(name string, j ctxJob) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("RegisterJob: job " + name + " is already registered")
+	}
+	registry[name] = registeredJob{job: func(*Hasher) ctxJob {
+		return j
+	}}
+}
+
+// ParsePipelineConfig reads a config from JSON, when data starts with '{',
+// or from YAML.
+func ParsePipelineConfig(data []byte) (*PipelineConfig, error) {
+	c := &PipelineConfig{}
+
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad pipeline config: %w", err)
+	}
+
+	return c, nil
+}
+
+func LoadPipelineConfig(path string) (*PipelineConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePipelineConfig(data)
+}
+
+// Pipeline builds the stages with the hash jobs of h, defaultHasher when h
+// is nil.
+func (c *PipelineConfig) Pipeline(h *Hasher) (*Pipeline, error) {
+	if h == nil {
+		h = defaultHasher
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	p := &Pipeline{Tracer: h.Tracer}
+	for i, s := range c.Stages {
+		r, ok := registry[s.Job]
+		if !ok {
+			return nil, fmt.Errorf("stage %d: unknown job %q", i, s.Job)
+		}
+
+		policy, ok := panicPolicies[s.OnPanic]
+		if !ok {
+			return nil, fmt.Errorf("stage %d: unknown panic policy %q", i, s.OnPanic)
+		}
+
+		var backoff time.Duration
+		if s.Backoff != "" {
+			var err error
+			backoff, err = time.ParseDuration(s.Backoff)
+			if err != nil {
+				return nil, fmt.Errorf("stage %d: %w", i, err)
+			}
+		}
+
+		if s.Workers < 0 || s.Buffer < 0 || s.MaxRestarts < 0 {
+			return nil, fmt.Errorf("stage %d: negative workers, buffer or max_restarts", i)
+		}
+
+		name := s.Name
+		if name == "" {
+			name = s.Job
+		}
+
+		sc := StageConfig{
+			Name:        name,
+			Buffer:      s.Buffer,
+			OnPanic:     policy,
+			Backoff:     backoff,
+			MaxRestarts: s.MaxRestarts,
+		}
+		switch {
+		case policy == PolicySkip && r.pool == nil:
+			return nil, fmt.Errorf("stage %d: job %s cannot skip values, only restart", i, s.Job)
+		case r.pool != nil:
+			workers := s.Workers
+			if workers == 0 {
+				workers = h.workers()
+			}
+			sc.Job = r.pool(h, workers)
+		case r.single && s.Workers > 1:
+			return nil, fmt.Errorf("stage %d: job %s cannot have several workers", i, s.Job)
+		default:
+			sc.Job = r.job(h)
+			sc.Workers = s.Workers
+		}
+
+		p.Stages = append(p.Stages, sc)
+	}
+
+	return p, nil
+}
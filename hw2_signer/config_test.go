@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// registerTestJob registers j for the time of the test.
+func registerTestJob(t *testing.T, name string, j ctxJob) {
+	RegisterJob(name, j)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		delete(registry, name)
+	})
+}
+
+func TestPipelineConfig(t *testing.T) {
+	testExpected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+
+	registerTestJob(t, "test/upper", func(ctx context.Context, in, out chan interface{}) error {
+		for v := range in {
+			if err := send(ctx, out, strings.ToUpper(v.(string))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	configs := map[string]string{
+		"yaml": `
+stages:
+  - job: SingleHash
+    workers: 2
+  - name: multi
+    job: MultiHash
+    buffer: 10
+    on_panic: restart
+    backoff: 10ms
+  - job: CombineResults
+  - job: test/upper
+`,
+		"json": `{"stages": [
+	{"job": "SingleHash", "workers": 2},
+	{"name": "multi", "job": "MultiHash", "buffer": 10, "on_panic": "restart", "backoff": "10ms"},
+	{"job": "CombineResults"},
+	{"job": "test/upper"}
+]}`,
+	}
+
+	for format, config := range configs {
+		c, err := ParsePipelineConfig([]byte(config))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+
+		p, err := c.Pipeline(&Hasher{Signer: FastSigner{}})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		// размер пула SingleHash, а не копии задачи
+		if p.Stages[0].Workers != 0 || p.Stages[1].Name != "multi" || p.Stages[1].Buffer != 10 ||
+			p.Stages[1].OnPanic != PolicyRestart || p.Stages[2].Name != "CombineResults" {
+			t.Errorf("%s: unexpected stages %+v", format, p.Stages)
+		}
+
+		outputs, err := runConfig(context.Background(), c, &Hasher{Signer: FastSigner{}}, []int{0, 1})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if len(outputs) != 1 || outputs[0] != testExpected {
+			t.Errorf("%s: results not match\nGot: %v\nExpected: %v", format, outputs, testExpected)
+		}
+	}
+}
+
+func TestPipelineConfigErrors(t *testing.T) {
+	configs := []string{
+		"stages:\n  - job: NoSuchJob\n",
+		"stages:\n  - job: SingleHash\n    on_panic: ignore\n",
+		"stages:\n  - job: SingleHash\n    backoff: soon\n",
+		"stages:\n  - job: SingleHash\n    workers: -1\n",
+		"stages:\n  - job: CombineResults\n    workers: 2\n",
+		"stages:\n  - job: CombineResults\n    on_panic: skip\n",
+	}
+
+	for _, config := range configs {
+		c, err := ParsePipelineConfig([]byte(config))
+		if err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+		if _, err := c.Pipeline(nil); err == nil {
+			t.Errorf("expected an error for %q", config)
+		}
+	}
+
+	// опечатка в имени поля не должна молча игнорироваться
+	for _, config := range []string{"stages:\n  - job: SingleHash\n    worker: 2\n", `{"stages": [{"jobs": "SingleHash"}]}`} {
+		if _, err := ParsePipelineConfig([]byte(config)); err == nil {
+			t.Errorf("expected an error for %q", config)
+		}
+	}
+}
+
+func TestCLIPipeline(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pipeline.yaml")
+	config := "stages:\n  - job: SingleHashOrdered\n"
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tracePath := filepath.Join(dir, "trace.json")
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	err := run([]string{"-signer", "fast", "-pipeline", path, "-chrome-trace", tracePath}, strings.NewReader("0\n1\n"), stdout, stderr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testExpected := "4108050209~502633748\n2212294583~709660146\n"
+	if stdout.String() != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", stdout.String(), testExpected)
+	}
+
+	trace, err := os.ReadFile(tracePath)
+	if err != nil {
+		t.Fatalf("trace is not written: %v", err)
+	}
+	if !json.Valid(trace) || !bytes.Contains(trace, []byte("SingleHashOrdered")) {
+		t.Errorf("unexpected trace %s", trace)
+	}
+}
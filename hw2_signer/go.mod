@@ -1,3 +1,5 @@
 module example.com/hw2
 
-go 1.17
+go 1.18
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrUnnamedStage   = errors.New("graph stage has no name")
+	ErrDuplicateStage = errors.New("duplicate graph stage")
+	ErrDanglingEdge   = errors.New("graph edge to an unknown stage")
+	ErrDuplicateEdge  = errors.New("duplicate graph edge")
+	ErrCycle          = errors.New("graph has a cycle")
+)
+
+type Edge struct {
+	From string
+	To   string
+}
+
+// Graph is a pipeline of named stages wired by edges. A stage with several
+// outgoing edges sends every value to each of them, a stage with several
+// incoming edges gets the values of all of them mixed, its input is closed
+// when all of them are done.
+type Graph struct {
+	Stages []StageConfig
+	Edges  []Edge
+}
+
+// Validate checks that the stage names are unique, every edge joins existing
+// stages and there are no cycles.
+func (g *Graph) Validate() error {
+	index := make(map[string]int, len(g.Stages))
+	for i, sc := range g.Stages {
+		if sc.Name == "" {
+			return fmt.Errorf("%w: stage %d", ErrUnnamedStage, i)
+		}
+		if _, ok := index[sc.Name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateStage, sc.Name)
+		}
+		index[sc.Name] = i
+	}
+
+	seen := make(map[Edge]bool, len(g.Edges))
+	inDegree := make([]int, len(g.Stages))
+	next := make([][]int, len(g.Stages))
+	for _, e := range g.Edges {
+		from, ok := index[e.From]
+		if !ok {
+			return fmt.Errorf("%w: %s -> %s", ErrDanglingEdge, e.From, e.To)
+		}
+		to, ok := index[e.To]
+		if !ok {
+			return fmt.Errorf("%w: %s -> %s", ErrDanglingEdge, e.From, e.To)
+		}
+		if seen[e] {
+			return fmt.Errorf("%w: %s -> %s", ErrDuplicateEdge, e.From, e.To)
+		}
+		seen[e] = true
+
+		next[from] = append(next[from], to)
+		inDegree[to]++
+	}
+
+	// Kahn: what is left after removing the stages without inputs is a cycle
+	var queue []int
+	for i, d := range inDegree {
+		if d == 0 {
+			queue = append(queue, i)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, j := range next[i] {
+			inDegree[j]--
+			if inDegree[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	if visited != len(g.Stages) {
+		cycle := g.findCycle(next, inDegree)
+		return fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+// findCycle returns the names along a cycle, the first one repeated at the
+// end. Kahn leaves the stages with inputs in inDegree, the cycles and the
+// stages after them; a depth-first walk over them meets a cycle as an edge
+// back to a stage on the walk.
+func (g *Graph) findCycle(next [][]int, inDegree []int) []string {
+	const (
+		unseen = iota
+		onPath
+		done
+	)
+	state := make([]int, len(g.Stages))
+	var path []int
+
+	var walk func(i int) []string
+	walk = func(i int) []string {
+		state[i] = onPath
+		path = append(path, i)
+		for _, j := range next[i] {
+			if inDegree[j] == 0 {
+				continue
+			}
+			switch state[j] {
+			case onPath:
+				var cycle []string
+				for k := len(path) - 1; k >= 0; k-- {
+					if path[k] == j {
+						for _, s := range path[k:] {
+							cycle = append(cycle, g.Stages[s].Name)
+						}
+						break
+					}
+				}
+				return append(cycle, g.Stages[j].Name)
+			case unseen:
+				if cycle := walk(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		return nil
+	}
+
+	for i, d := range inDegree {
+		if d > 0 && state[i] == unseen {
+			if cycle := walk(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// Run validates the graph and runs it like Pipeline.Run: the first failure
+// or the end of ctx stops every stage.
+func (g *Graph) Run(ctx context.Context) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	wg := &sync.WaitGroup{}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := ctx.Done()
+
+	var (
+		once sync.Once
+		ferr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			ferr = err
+			cancel()
+		})
+	}
+
+	index := make(map[string]int, len(g.Stages))
+	for i, sc := range g.Stages {
+		index[sc.Name] = i
+	}
+
+	inputs := make([]chan interface{}, len(g.Stages))
+	producers := make([]int32, len(g.Stages))
+	next := make([][]int, len(g.Stages))
+	for i, sc := range g.Stages {
+		inputs[i] = make(chan interface{}, sc.Buffer)
+	}
+	for _, e := range g.Edges {
+		from, to := index[e.From], index[e.To]
+		producers[to]++
+		next[from] = append(next[from], to)
+	}
+	for i := range g.Stages {
+		if producers[i] == 0 {
+			close(inputs[i])
+		}
+	}
+
+	for i, sc := range g.Stages {
+		to := make([]chan interface{}, len(next[i]))
+		for k, j := range next[i] {
+			to[k] = inputs[j]
+		}
+		// the last producer of a stage closes its input
+		release := func(next []int) func() {
+			return func() {
+				for _, j := range next {
+					if atomic.AddInt32(&producers[j], -1) == 0 {
+						close(inputs[j])
+					}
+				}
+			}
+		}(next[i])
+
+		out := make(chan interface{})
+
+		wg.Add(2)
+		go jobWorker(ctx, sc, i, nil, &stageStats{name: sc.Name}, inputs[i], out, fail, wg)
+		go tee(out, to, done, release, wg)
+	}
+
+	wg.Wait()
+
+	once.Do(func() {
+		ferr = ctx.Err()
+	})
+	return ferr
+}
+
+// tee sends every value from from to all of to. When from is closed or the
+// graph is done, it releases to and drains from.
+func tee(from <-chan interface{}, to []chan interface{}, done <-chan struct{}, release func(), wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for cancelled := false; !cancelled; {
+		select {
+		case v, ok := <-from:
+			if !ok {
+				cancelled = true
+				break
+			}
+			for _, ch := range to {
+				select {
+				case ch <- v:
+				case <-done:
+					cancelled = true
+				}
+				if cancelled {
+					break
+				}
+			}
+		case <-done:
+			cancelled = true
+		}
+	}
+
+	release()
+	for range from {
+	}
+}
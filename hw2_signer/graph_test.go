@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGraphTeeMerge(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		result []int
+	)
+
+	mul := func(k int) ctxJob {
+		return func(ctx context.Context, in, out chan interface{}) error {
+			for v := range in {
+				if err := send(ctx, out, v.(int)*k); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	// source раздаёт значения двум стадиям, их результаты сливаются в sink
+	g := &Graph{
+		Stages: []StageConfig{
+			{Name: "source", Job: func(ctx context.Context, in, out chan interface{}) error {
+				for i := 1; i <= 3; i++ {
+					if err := send(ctx, out, i); err != nil {
+						return err
+					}
+				}
+				return nil
+			}},
+			{Name: "double", Job: mul(2)},
+			{Name: "tenfold", Job: mul(10), Workers: 2},
+			{Name: "sink", Job: func(ctx context.Context, in, out chan interface{}) error {
+				for v := range in {
+					mu.Lock()
+					result = append(result, v.(int))
+					mu.Unlock()
+				}
+				return nil
+			}},
+		},
+		Edges: []Edge{
+			{"source", "double"},
+			{"source", "tenfold"},
+			{"double", "sink"},
+			{"tenfold", "sink"},
+		},
+	}
+
+	if err := g.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sort.Ints(result)
+	expected := []int{2, 4, 6, 10, 20, 30}
+	if len(result) != len(expected) {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Fatalf("results not match\nGot: %v\nExpected: %v", result, expected)
+		}
+	}
+}
+
+func TestGraphValidate(t *testing.T) {
+	nop := ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+		return nil
+	})
+	stages := []StageConfig{{Name: "a", Job: nop}, {Name: "b", Job: nop}, {Name: "c", Job: nop}}
+
+	cases := []struct {
+		graph    Graph
+		expected error
+	}{
+		{Graph{Stages: stages, Edges: []Edge{{"a", "b"}, {"b", "c"}}}, nil},
+		{Graph{Stages: stages, Edges: []Edge{{"a", "b"}, {"b", "c"}, {"c", "b"}}}, ErrCycle},
+		{Graph{Stages: stages, Edges: []Edge{{"a", "a"}}}, ErrCycle},
+		{Graph{Stages: stages, Edges: []Edge{{"a", "d"}}}, ErrDanglingEdge},
+		{Graph{Stages: stages, Edges: []Edge{{"a", "b"}, {"a", "b"}}}, ErrDuplicateEdge},
+		{Graph{Stages: append(stages[:2:2], StageConfig{Name: "a", Job: nop})}, ErrDuplicateStage},
+		{Graph{Stages: []StageConfig{{Job: nop}}}, ErrUnnamedStage},
+	}
+
+	for i, c := range cases {
+		err := c.graph.Validate()
+		if !errors.Is(err, c.expected) || (c.expected == nil && err != nil) {
+			t.Errorf("case %d: unexpected error\nGot: %v\nExpected: %v", i, err, c.expected)
+		}
+	}
+
+	// c стоит после цикла, но в него не входит
+	g := Graph{
+		Stages: []StageConfig{{Name: "c", Job: nop}, {Name: "a", Job: nop}, {Name: "b", Job: nop}},
+		Edges:  []Edge{{"a", "b"}, {"b", "a"}, {"a", "c"}},
+	}
+	expected := "graph has a cycle: a -> b -> a"
+	if err := g.Validate(); err == nil || err.Error() != expected {
+		t.Errorf("unexpected error\nGot: %v\nExpected: %v", err, expected)
+	}
+}
+
+func TestGraphError(t *testing.T) {
+	errBroken := errors.New("broken")
+
+	// одна ветка падает, вторая бесконечна - граф должен остановиться
+	g := &Graph{
+		Stages: []StageConfig{
+			{Name: "source", Job: func(ctx context.Context, in, out chan interface{}) error {
+				for i := 0; ; i++ {
+					if err := send(ctx, out, i); err != nil {
+						return err
+					}
+				}
+			}},
+			{Name: "broken", Job: func(ctx context.Context, in, out chan interface{}) error {
+				<-in
+				return errBroken
+			}},
+			{Name: "drain", Job: func(ctx context.Context, in, out chan interface{}) error {
+				for range in {
+				}
+				return nil
+			}},
+		},
+		Edges: []Edge{{"source", "broken"}, {"source", "drain"}},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- g.Run(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errBroken) {
+			t.Errorf("unexpected error\nGot: %v\nExpected: %v", err, errBroken)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("execition too long")
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cliItem struct {
+	Data       string `json:"data"`
+	SingleHash string `json:"single_hash"`
+	MultiHash  string `json:"multi_hash"`
+}
+
+type cliResult struct {
+	Salt   string    `json:"salt"`
+	Items  []cliItem `json:"items"`
+	Result string    `json:"result"`
+}
+
+func readValues(r io.Reader) ([]int, error) {
+	var values []int
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		v, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("bad input line %q: %w", line, err)
+		}
+		values = append(values, v)
+	}
+
+	return values, scanner.Err()
+}
+
+// collectJob passes values through and keeps a copy of them.
+func collectJob(collected *[]string) ctxJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		for {
+			v, ok := recv(ctx, in, nil)
+			if !ok {
+				return ctx.Err()
+			}
+			*collected = append(*collected, v.(string))
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func signValues(ctx context.Context, h *Hasher, values []int) (res cliResult, ferr error) {
+	var singles, multis []string
+
+	p := &Pipeline{
+		Tracer: h.Tracer,
+		Stages: []StageConfig{
+			{Name: "input", Job: func(ctx context.Context, _, out chan interface{}) error {
+				for _, v := range values {
+					if err := send(ctx, out, v); err != nil {
+						return err
+					}
+				}
+				return nil
+			}},
+			{Name: "SingleHash", Job: WorkerPool(h.workers(), true, h.singleHashItem)},
+			{Name: "collect SingleHash", Job: collectJob(&singles)},
+			{Name: "MultiHash", Job: WorkerPool(h.workers(), true, h.multiHashItem)},
+			{Name: "collect MultiHash", Job: collectJob(&multis)},
+			{Name: "CombineResults", Job: fromErrJob(h.CombineResultsE)},
+			{Name: "output", Job: func(ctx context.Context, in, _ chan interface{}) error {
+				for v := range in {
+					res.Result = v.(string)
+				}
+				return nil
+			}},
+		},
+	}
+
+	ferr = p.Run(ctx)
+	if ferr != nil {
+		return
+	}
+
+	res.Salt = h.salt()
+	for i, v := range values {
+		res.Items = append(res.Items, cliItem{
+			Data:       strconv.Itoa(v),
+			SingleHash: singles[i],
+			MultiHash:  multis[i],
+		})
+	}
+	return
+}
+
+// runConfig feeds values to the stages of c and returns what the last one
+// has sent.
+func runConfig(ctx context.Context, c *PipelineConfig, h *Hasher, values []int) (outputs []string, ferr error) {
+	p, ferr := c.Pipeline(h)
+	if ferr != nil {
+		return
+	}
+
+	input := StageConfig{Name: "input", Job: func(ctx context.Context, _, out chan interface{}) error {
+		for _, v := range values {
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+	output := StageConfig{Name: "output", Job: func(ctx context.Context, in, _ chan interface{}) error {
+		for v := range in {
+			outputs = append(outputs, fmt.Sprint(v))
+		}
+		return nil
+	}}
+	p.Stages = append(append([]StageConfig{input}, p.Stages...), output)
+
+	ferr = p.Run(ctx)
+	return
+}
+
+func writeChromeTrace(path string, t *Tracer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := t.WriteChrome(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// signers are the -signer backends, made for the -salt value.
+var (
+	signersMu sync.RWMutex
+	signers   = map[string]func(salt string) Signer{
+		"data": func(string) Signer {
+			return DataSigner{}
+		},
+		"fast": func(salt string) Signer {
+			return FastSigner{Salt: salt}
+		},
+		"sha256": func(salt string) Signer {
+			return SHA256Signer{Salt: salt}
+		},
+		"xxhash": func(salt string) Signer {
+			return XXHashSigner{Salt: salt}
+		},
+	}
+)
+
+// RegisterSigner makes newSigner available to -signer under name. It panics
+// if the name is taken.
+func RegisterSigner(name string, newSigner func(salt string) Signer) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+
+	if _, ok := signers[name]; ok {
+		panic("RegisterSigner: signer " + name + " is already registered")
+	}
+	signers[name] = newSigner
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) (ferr error) {
+	flags := flag.NewFlagSet("hw2", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		input       = flags.String("in", "", "file with a value per line, stdin by default")
+		salt        = flags.String("salt", DataSignerSalt, "DataSignerSalt value")
+		trace       = flags.Bool("trace", false, "print every hashing step to stderr")
+		chromeTrace = flags.String("chrome-trace", "", "file to write the Chrome trace-event JSON to")
+		signer      = flags.String("signer", "data", "hash backend: data, fast, sha256, xxhash or one added by RegisterSigner")
+		jsonOutput  = flags.Bool("json", false, "print the result as JSON")
+		rounds      = flags.Int("rounds", 0, "number of MultiHash rounds, 6 by default")
+		prefixes    = flags.String("prefixes", "", "comma-separated MultiHash round prefixes instead of the round numbers")
+		separator   = flags.String("separator", "", "string to join the MultiHash rounds with")
+		worker      = flags.String("worker", "", "serve the -signer hashes over RPC on this address instead of hashing input")
+		workers     = flags.String("workers", "", "comma-separated addresses of the RPC workers to hash with")
+		checkpoint  = flags.String("checkpoint", "", "file to keep the finished hashes in, a run started again skips them")
+		verify      = flags.String("verify", "", "signature to check against the input instead of printing one")
+		pipeline    = flags.String("pipeline", "", "JSON or YAML file with the stages to run instead of the hw2 chain")
+		memo        = flags.Int("memo", 0, "remember up to this many hashes, so duplicate inputs are hashed once")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	DataSignerSalt = *salt
+
+	h := &Hasher{Rounds: *rounds, Separator: *separator}
+	if *prefixes != "" {
+		h.Prefixes = strings.Split(*prefixes, ",")
+	}
+	signersMu.RLock()
+	newSigner, ok := signers[*signer]
+	signersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown signer %q", *signer)
+	}
+	h.Signer = newSigner(*salt)
+
+	if *worker != "" {
+		l, err := net.Listen("tcp", *worker)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stderr, "signer worker listening on", l.Addr())
+		server := &SignerServer{Signer: h.Signer}
+		return server.Serve(l)
+	}
+	if *workers != "" {
+		rs := NewRPCSigner(time.Second, strings.Split(*workers, ",")...)
+		defer rs.Close()
+		h.Signer = rs
+	}
+	if *memo > 0 {
+		h.Signer = NewSignerCache(h.Signer, *memo)
+	}
+
+	// the trace is written whatever way the run ends
+	if *chromeTrace != "" {
+		h.Tracer = NewTracer()
+		defer func() {
+			if err := writeChromeTrace(*chromeTrace, h.Tracer); err != nil && ferr == nil {
+				ferr = err
+			}
+		}()
+	}
+
+	r := stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	values, err := readValues(r)
+	if err != nil {
+		return err
+	}
+
+	if *verify != "" {
+		inputs := make([]interface{}, len(values))
+		for i, v := range values {
+			inputs[i] = v
+		}
+		report, err := h.Verify(inputs, *salt, *verify)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, report)
+		if !report.OK() {
+			return ErrSignatureMismatch
+		}
+		return nil
+	}
+
+	if *checkpoint != "" {
+		// the hashes of the workers are the ones of their backend, which
+		// only their addresses tell
+		identity := *signer
+		if *workers != "" {
+			identity = "workers " + *workers
+		}
+		c, err := OpenCheckpoint(*checkpoint, identity)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		h.Checkpoint = c
+	}
+	if *trace {
+		mu := &sync.Mutex{}
+		h.Logf = func(format string, args ...interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(stderr, format+"\n", args...)
+		}
+	}
+
+	if *pipeline != "" {
+		c, err := LoadPipelineConfig(*pipeline)
+		if err != nil {
+			return err
+		}
+		outputs, err := runConfig(context.Background(), c, h, values)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "\t")
+			return enc.Encode(outputs)
+		}
+		for _, v := range outputs {
+			fmt.Fprintln(stdout, v)
+		}
+		return nil
+	}
+
+	res, err := signValues(context.Background(), h, values)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(res)
+	}
+
+	fmt.Fprintln(stdout, res.Result)
+	return nil
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
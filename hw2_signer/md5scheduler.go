@@ -0,0 +1,178 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Md5Cost is how long a single DataSignerMd5 call takes.
+const Md5Cost = 10 * time.Millisecond
+
+// dataSignerMd5Mu serialises the DataSignerMd5 calls of all schedulers, one
+// at a time they never hit the overheat.
+var dataSignerMd5Mu sync.Mutex
+
+func lockedDataSignerMd5(data string) string {
+	dataSignerMd5Mu.Lock()
+	defer dataSignerMd5Mu.Unlock()
+
+	return DataSignerMd5(data)
+}
+
+// md5Call is a hash in the queue or in flight, shared by all the requests
+// for its data.
+type md5Call struct {
+	data    string
+	done    chan struct{}
+	started time.Time
+	res     string
+	perr    *PanicError
+}
+
+type Md5SchedulerStats struct {
+	// Served is the number of answered requests
+	Served uint64
+	// Shared are the served requests that got the result of a call made
+	// for another request with the same data
+	Shared    uint64
+	Queued    int
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+func (st Md5SchedulerStats) AvgWait() time.Duration {
+	if st.Served == 0 {
+		return 0
+	}
+	return st.TotalWait / time.Duration(st.Served)
+}
+
+// Md5Scheduler makes the md5 calls one at a time, in the arrival order. The
+// schedulers made by NewMd5Scheduler share a lock, so they never call
+// DataSignerMd5 at the same time and the overheat never happens.
+type Md5Scheduler struct {
+	// Interval is the minimal pause between the end of a call and the next one.
+	Interval time.Duration
+	// Dedup lets the requests for data already waiting or in flight share
+	// that call, so a burst of duplicates costs a single call. hw2 expects a
+	// DataSignerMd5 call per input, so the scheduler of DataSigner has it off.
+	Dedup bool
+
+	md5      func(data string) string
+	clock    Clock
+	requests chan *md5Call
+
+	mu      sync.Mutex
+	pending map[string]*md5Call
+	stats   Md5SchedulerStats
+}
+
+func NewMd5Scheduler(interval time.Duration) *Md5Scheduler {
+	return newMd5Scheduler(interval, SignerClock, lockedDataSignerMd5)
+}
+
+// newMd5Scheduler makes a scheduler for another md5 function, which the
+// scheduler is meant to be the only caller of.
+func newMd5Scheduler(interval time.Duration, clock Clock, md5 func(data string) string) *Md5Scheduler {
+	s := &Md5Scheduler{
+		Interval: interval,
+		md5:      md5,
+		clock:    clock,
+		requests: make(chan *md5Call, MaxInputDataLen),
+		pending:  make(map[string]*md5Call),
+	}
+	go s.loop()
+	return s
+}
+
+// Sign returns DataSignerMd5 of data. If DataSignerMd5 panics, Sign panics
+// with the same PanicError in the caller goroutine.
+func (s *Md5Scheduler) Sign(data string) string {
+	queued := s.clock.Now()
+
+	s.mu.Lock()
+	call, shared := s.pending[data]
+	if !shared {
+		call = &md5Call{data: data, done: make(chan struct{})}
+		if s.Dedup {
+			s.pending[data] = call
+		}
+	}
+	s.mu.Unlock()
+
+	if !shared {
+		s.requests <- call
+	}
+	<-call.done
+
+	// a request that joined the call in flight has not waited for it
+	wait := call.started.Sub(queued)
+	if wait < 0 {
+		wait = 0
+	}
+	s.record(wait, shared)
+
+	if call.perr != nil {
+		panic(call.perr)
+	}
+	return call.res
+}
+
+// EstimatedWait is how long a request made now would wait in the queue.
+func (s *Md5Scheduler) EstimatedWait() time.Duration {
+	return time.Duration(len(s.requests)) * (Md5Cost + s.Interval)
+}
+
+func (s *Md5Scheduler) Stats() Md5SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Queued = len(s.requests)
+	return stats
+}
+
+// Close stops the scheduler after the queued requests are served. Sign must
+// not be called after Close.
+func (s *Md5Scheduler) Close() {
+	close(s.requests)
+}
+
+func (s *Md5Scheduler) loop() {
+	var last time.Time
+
+	for call := range s.requests {
+		if pause := s.Interval - s.clock.Now().Sub(last); s.Interval > 0 && !last.IsZero() && pause > 0 {
+			s.clock.Sleep(pause)
+		}
+
+		call.started = s.clock.Now()
+		call.perr = catch(func() {
+			call.res = s.md5(call.data)
+		})
+
+		// the requests coming from now on make a new call
+		s.mu.Lock()
+		if s.pending[call.data] == call {
+			delete(s.pending, call.data)
+		}
+		s.mu.Unlock()
+
+		close(call.done)
+		last = s.clock.Now()
+	}
+}
+
+func (s *Md5Scheduler) record(wait time.Duration, shared bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Served++
+	if shared {
+		s.stats.Shared++
+	}
+	s.stats.TotalWait += wait
+	if wait > s.stats.MaxWait {
+		s.stats.MaxWait = wait
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+type memoKey struct {
+	salt string
+	data string
+}
+
+type memoEntry struct {
+	key memoKey
+	res string
+}
+
+type memoCall struct {
+	done chan struct{}
+	res  string
+	perr *PanicError
+}
+
+type HashMemoStats struct {
+	Hits   uint64
+	Misses uint64
+	Shared uint64
+	Size   int
+}
+
+// HashMemo remembers results of a slow hash function. Concurrent calls with
+// the same data wait for the one in flight instead of computing again, and
+// only capacity least recently used results are kept. The salt is a part of
+// the key, since the signers add it to the data. If fn panics, the waiting
+// calls panic with the same PanicError and nothing is remembered.
+type HashMemo struct {
+	fn       func(data string) string
+	capacity int
+
+	mu       sync.Mutex
+	entries  map[memoKey]*list.Element
+	lru      *list.List
+	inflight map[memoKey]*memoCall
+	stats    HashMemoStats
+}
+
+func NewHashMemo(fn func(data string) string, capacity int) *HashMemo {
+	return &HashMemo{
+		fn:       fn,
+		capacity: capacity,
+		entries:  make(map[memoKey]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[memoKey]*memoCall),
+	}
+}
+
+// Hash returns fn(data) for a fn that hashes with DataSignerSalt, as
+// DataSignerMd5 and DataSignerCrc32 do.
+func (m *HashMemo) Hash(data string) string {
+	return m.hash(data, DataSignerSalt, m.fn)
+}
+
+// hash returns the result remembered for data and salt, or fn(data), which
+// has to hash with salt.
+func (m *HashMemo) hash(data, salt string, fn func(data string) string) string {
+	key := memoKey{salt: salt, data: data}
+
+	m.mu.Lock()
+	if el, ok := m.entries[key]; ok {
+		m.lru.MoveToFront(el)
+		m.stats.Hits++
+		m.mu.Unlock()
+		return el.Value.(*memoEntry).res
+	}
+	if call, ok := m.inflight[key]; ok {
+		m.stats.Shared++
+		m.mu.Unlock()
+		<-call.done
+		if call.perr != nil {
+			panic(call.perr)
+		}
+		return call.res
+	}
+	call := &memoCall{done: make(chan struct{})}
+	m.inflight[key] = call
+	m.stats.Misses++
+	m.mu.Unlock()
+
+	defer close(call.done)
+
+	call.perr = catch(func() {
+		call.res = fn(data)
+	})
+
+	m.mu.Lock()
+	delete(m.inflight, key)
+	if call.perr == nil {
+		m.add(key, call.res)
+	}
+	m.mu.Unlock()
+
+	if call.perr != nil {
+		panic(call.perr)
+	}
+	return call.res
+}
+
+func (m *HashMemo) add(key memoKey, res string) {
+	if m.capacity <= 0 {
+		return
+	}
+
+	m.entries[key] = m.lru.PushFront(&memoEntry{key: key, res: res})
+	for m.lru.Len() > m.capacity {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoEntry).key)
+	}
+}
+
+func (m *HashMemo) Stats() HashMemoStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Size = m.lru.Len()
+	return stats
+}
+
+// SignerCache is a Signer that memoises another one, so duplicate inputs
+// are hashed only once. It hashes with the salt of that signer, which has to
+// be a SaltedSigner for other salts.
+type SignerCache struct {
+	Md5Memo   *HashMemo
+	Crc32Memo *HashMemo
+
+	signer Signer
+}
+
+func NewSignerCache(s Signer, capacity int) *SignerCache {
+	return &SignerCache{
+		Md5Memo:   NewHashMemo(s.Md5, capacity),
+		Crc32Memo: NewHashMemo(s.Crc32, capacity),
+		signer:    s,
+	}
+}
+
+func (c *SignerCache) salt() string {
+	return saltOf(c.signer)
+}
+
+func (c *SignerCache) Md5(data string) string {
+	return c.Md5Memo.hash(data, c.salt(), c.signer.Md5)
+}
+
+func (c *SignerCache) Crc32(data string) string {
+	return c.Crc32Memo.hash(data, c.salt(), c.signer.Crc32)
+}
+
+func (c *SignerCache) SaltedMd5(data, salt string) string {
+	if salt == c.salt() {
+		return c.Md5(data)
+	}
+	return c.Md5Memo.hash(data, salt, func(data string) string {
+		return mustSalted(c.signer).SaltedMd5(data, salt)
+	})
+}
+
+func (c *SignerCache) SaltedCrc32(data, salt string) string {
+	if salt == c.salt() {
+		return c.Crc32(data)
+	}
+	return c.Crc32Memo.hash(data, salt, func(data string) string {
+		return mustSalted(c.signer).SaltedCrc32(data, salt)
+	})
+}
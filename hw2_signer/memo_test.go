@@ -0,0 +1,188 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHashMemoSingleFlight(t *testing.T) {
+	var calls uint32
+	m := NewHashMemo(func(data string) string {
+		atomic.AddUint32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "#" + data
+	}, 10)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res := m.Hash("1"); res != "#1" {
+				t.Errorf("results not match\nGot: %v\nExpected: %v", res, "#1")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("computed %d times instead of once", calls)
+	}
+}
+
+func TestHashMemoPanic(t *testing.T) {
+	var calls uint32
+	m := NewHashMemo(func(data string) string {
+		if atomic.AddUint32(&calls, 1) == 1 {
+			time.Sleep(50 * time.Millisecond)
+			panic("hash is broken")
+		}
+		return "#" + data
+	}, 10)
+
+	// ожидающий вызов получает ту же панику, а не висит
+	perrs := make([]*PanicError, 2)
+	wg := &sync.WaitGroup{}
+	for i := range perrs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			perrs[i] = catch(func() {
+				m.Hash("1")
+			})
+		}(i)
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if perrs[0] == nil || perrs[0] != perrs[1] {
+		t.Fatalf("expected the same panic in both calls, got %v and %v", perrs[0], perrs[1])
+	}
+
+	done := make(chan string)
+	go func() {
+		done <- m.Hash("1")
+	}()
+	select {
+	case res := <-done:
+		if res != "#1" {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", res, "#1")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call after the panic hangs")
+	}
+}
+
+func TestHashMemoEviction(t *testing.T) {
+	var calls uint32
+	m := NewHashMemo(func(data string) string {
+		atomic.AddUint32(&calls, 1)
+		return "#" + data
+	}, 2)
+
+	for _, data := range []string{"1", "2", "1", "3", "1", "2"} {
+		m.Hash(data)
+	}
+
+	// 2 вытесняется тройкой, единица остается как самая свежая
+	if calls != 4 {
+		t.Errorf("unexpected number of calls\nGot: %d\nExpected: %d", calls, 4)
+	}
+	if stats := m.Stats(); stats.Size != 2 || stats.Hits != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHashMemoSalt(t *testing.T) {
+	t.Parallel()
+
+	c := NewSignerCache(FastSigner{Salt: "a"}, 10)
+
+	plain := c.Md5("1")
+	first := c.SaltedMd5("1", "b")
+	second := c.SaltedMd5("1", "c")
+
+	if first == second || first == plain {
+		t.Errorf("salt is not a part of the key: %v, %v, %v", plain, first, second)
+	}
+	if expected := (FastSigner{}).SaltedMd5("1", "b"); first != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", first, expected)
+	}
+	if res := c.SaltedMd5("1", "a"); res != plain {
+		t.Errorf("signer salt is hashed apart\nGot: %v\nExpected: %v", res, plain)
+	}
+}
+
+// saltSigner это "хеш", который просто дописывает DataSignerSalt
+type saltSigner struct{}
+
+func (saltSigner) Md5(data string) string {
+	return data + DataSignerSalt
+}
+
+func (saltSigner) Crc32(data string) string {
+	return data + DataSignerSalt
+}
+
+func TestSignerCacheDataSignerSalt(t *testing.T) {
+	saltOrig := DataSignerSalt
+	t.Cleanup(func() {
+		DataSignerSalt = saltOrig
+	})
+
+	c := NewSignerCache(saltSigner{}, 10)
+
+	DataSignerSalt = "a"
+	first := c.Crc32("1")
+	DataSignerSalt = "b"
+	second := c.Crc32("1")
+
+	if first != "1a" || second != "1b" {
+		t.Errorf("result for another DataSignerSalt is reused: %v, %v", first, second)
+	}
+}
+
+func TestSignerCacheDuplicates(t *testing.T) {
+	t.Parallel()
+
+	inputData := []int{1, 1, 1, 2, 2}
+	counter := &countingSigner{Signer: FastSigner{}}
+	h := &Hasher{Signer: NewSignerCache(counter, MaxInputDataLen)}
+
+	fast := &Hasher{Signer: FastSigner{}}
+	var expected, result []string
+	for _, v := range []int{1, 2} {
+		expected = append(expected, fast.multiHash(fast.singleHash(strconv.Itoa(v))))
+	}
+
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, v := range inputData {
+				out <- v
+			}
+		}),
+		job(h.SingleHash),
+		job(h.MultiHash),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				result = append(result, v.(string))
+			}
+		}),
+	)
+
+	// по 8 вызовов crc32 на каждое уникальное значение
+	if counter.crc32Calls != 2*8 {
+		t.Errorf("duplicates were computed again\nGot: %d\nExpected: %d", counter.crc32Calls, 2*8)
+	}
+	if len(result) != len(inputData) {
+		t.Fatalf("items lost, got %v", result)
+	}
+	for _, res := range result {
+		if res != expected[0] && res != expected[1] {
+			t.Errorf("unexpected result %v", res)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type errJob func(in, out chan interface{}) error
+
+type ctxJob func(ctx context.Context, in, out chan interface{}) error
+
+// ExecutePipelineE runs jobs like ExecutePipeline, but stops the whole chain
+// on the first failed job: the next jobs see their input closed, the previous
+// ones get their output drained, and the error is returned.
+func ExecutePipelineE(jobs ...errJob) error {
+	ctxJobs := make([]ctxJob, 0, len(jobs))
+	for _, j := range jobs {
+		ctxJobs = append(ctxJobs, fromErrJob(j))
+	}
+
+	return ExecutePipelineCtx(context.Background(), ctxJobs...)
+}
+
+// ExecutePipelineCtx is ExecutePipelineE with jobs that watch ctx. When ctx is
+// cancelled or its deadline passes, the pipeline is stopped the same way as
+// on a job failure and ctx.Err() is returned.
+func ExecutePipelineCtx(ctx context.Context, jobs ...ctxJob) error {
+	p := &Pipeline{}
+	for _, j := range jobs {
+		p.Stages = append(p.Stages, StageConfig{Job: j})
+	}
+
+	return p.Run(ctx)
+}
+
+type StageConfig struct {
+	Name string
+	Job  ctxJob
+	// Buffer is the capacity of the stage input channel, the previous job
+	// sends to it directly. With no Buffer a send returns only when the job
+	// takes the value, as in ExecutePipeline.
+	Buffer int
+	// Workers is the number of job copies sharing the stage input and output.
+	// Every copy sees only a part of the input, so it suits jobs without
+	// state across values: CombineResults and other aggregating jobs would
+	// give a result per copy. Each copy of a WorkerPool job runs a pool of
+	// its own, for the hashers that is Hasher.Workers calls per copy.
+	Workers int
+	// OnPanic is one of PolicyFail, PolicySkip or PolicyRestart.
+	OnPanic int
+	// Backoff is the pause before a restart, the first one with PolicyRestart.
+	// It is kept between 10ms and a minute.
+	Backoff time.Duration
+	// MaxRestarts limits restarts after panics, 0 means no limit.
+	MaxRestarts int
+}
+
+func (sc StageConfig) name(i int) string {
+	if sc.Name != "" {
+		return sc.Name
+	}
+	return "job " + strconv.Itoa(i)
+}
+
+type Pipeline struct {
+	Stages []StageConfig
+	// Tracer records a span for every stage run, nil disables it
+	Tracer *Tracer
+
+	mu    sync.Mutex
+	stats []*stageStats
+}
+
+// Run executes the stages as ExecutePipelineCtx does. A Pipeline can be run
+// once at a time; Stats reflects the latest run.
+func (p *Pipeline) Run(ctx context.Context) error {
+	wg := &sync.WaitGroup{}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once sync.Once
+		ferr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			ferr = err
+			cancel()
+		})
+	}
+
+	stats := make([]*stageStats, len(p.Stages))
+	// the input of a stage is the output of the previous one, the last
+	// output is thrown away
+	chans := make([]chan interface{}, len(p.Stages)+1)
+	for i, sc := range p.Stages {
+		chans[i] = make(chan interface{}, sc.Buffer)
+		stats[i] = &stageStats{name: sc.name(i), queue: chans[i]}
+	}
+	chans[len(p.Stages)] = make(chan interface{})
+	p.mu.Lock()
+	p.stats = stats
+	p.mu.Unlock()
+
+	close(chans[0])
+	for i, sc := range p.Stages {
+		wg.Add(1)
+		go jobWorker(ctx, sc, i, p.Tracer, stats[i], chans[i], chans[i+1], fail, wg)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range chans[len(p.Stages)] {
+		}
+	}()
+
+	wg.Wait()
+
+	once.Do(func() {
+		ferr = ctx.Err()
+	})
+	return ferr
+}
+
+// Stats returns a snapshot of per-stage counters of the current or the last run.
+func (p *Pipeline) Stats() []StageStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshot := make([]StageStats, 0, len(p.stats))
+	for _, st := range p.stats {
+		snapshot = append(snapshot, st.snapshot())
+	}
+	return snapshot
+}
+
+// StageStats are counted by send and recv, which the jobs of this package
+// use. The values a job passes with plain channel operations are not counted.
+type StageStats struct {
+	Name     string
+	ItemsIn  uint64
+	ItemsOut uint64
+	// SendBlocked is how long the stage output waited for the next stage.
+	SendBlocked time.Duration
+	// RecvBlocked is how long the stage input waited for the previous stage.
+	RecvBlocked time.Duration
+	// QueueDepth is the number of values in the stage input channel.
+	QueueDepth int
+	Panics     uint64
+}
+
+type stageStats struct {
+	name        string
+	queue       chan interface{}
+	itemsIn     uint64
+	itemsOut    uint64
+	sendBlocked int64
+	recvBlocked int64
+	panics      uint64
+	restarts    int32
+}
+
+type stageStatsKey struct{}
+
+// stageOf returns the stats of the stage running the job, nil outside a Pipeline.
+func stageOf(ctx context.Context) *stageStats {
+	st, _ := ctx.Value(stageStatsKey{}).(*stageStats)
+	return st
+}
+
+func (st *stageStats) addPanic() {
+	atomic.AddUint64(&st.panics, 1)
+}
+
+// addRestart counts a restart of the stage and tells whether it is within
+// max, 0 means no limit.
+func (st *stageStats) addRestart(max int) bool {
+	n := atomic.AddInt32(&st.restarts, 1)
+	return max == 0 || int(n) <= max
+}
+
+func (st *stageStats) snapshot() StageStats {
+	return StageStats{
+		Name:        st.name,
+		ItemsIn:     atomic.LoadUint64(&st.itemsIn),
+		ItemsOut:    atomic.LoadUint64(&st.itemsOut),
+		SendBlocked: time.Duration(atomic.LoadInt64(&st.sendBlocked)),
+		RecvBlocked: time.Duration(atomic.LoadInt64(&st.recvBlocked)),
+		QueueDepth:  len(st.queue),
+		Panics:      atomic.LoadUint64(&st.panics),
+	}
+}
+
+func addDuration(counter *int64, start time.Time) {
+	atomic.AddInt64(counter, int64(time.Since(start)))
+}
+
+// jobWorker runs the copies of the stage job. When they are over, it closes
+// out and throws away what is left in in, so that the previous job never
+// blocks on a stage that has failed or stopped reading.
+func jobWorker(ctx context.Context, sc StageConfig, i int, tracer *Tracer, st *stageStats, in, out chan interface{}, fail func(error), wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	start := SignerClock.Now()
+	ctx = context.WithValue(ctx, stageStatsKey{}, st)
+
+	copies := &sync.WaitGroup{}
+	for k := 0; k < sc.Workers || k == 0; k++ {
+		copies.Add(1)
+		go func() {
+			defer copies.Done()
+
+			if err := runJob(ctx, sc, st, in, out); err != nil {
+				fail(fmt.Errorf("%s: %w", sc.name(i), err))
+			}
+		}()
+	}
+	copies.Wait()
+
+	tracer.Record(Span{Stage: sc.name(i), Start: start, End: SignerClock.Now()})
+	close(out)
+	for range in {
+	}
+}
+
+// mustJob turns an errJob into a job, which can only report failure by panic.
+func mustJob(j errJob) job {
+	return func(in, out chan interface{}) {
+		if err := j(in, out); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func mustCtxJob(j ctxJob) job {
+	return mustJob(func(in, out chan interface{}) error {
+		return j(context.Background(), in, out)
+	})
+}
+
+func fromJob(j job) errJob {
+	return func(in, out chan interface{}) error {
+		j(in, out)
+		return nil
+	}
+}
+
+func fromErrJob(j errJob) ctxJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		return j(in, out)
+	}
+}
+
+// send puts v to out unless ctx is done first. In a Pipeline the value and
+// the wait count to the stage stats.
+func send(ctx context.Context, out chan<- interface{}, v interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	st := stageOf(ctx)
+
+	select {
+	case out <- v:
+	default:
+		start := time.Now()
+		var err error
+		select {
+		case out <- v:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if st != nil {
+			addDuration(&st.sendBlocked, start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if st != nil {
+		atomic.AddUint64(&st.itemsOut, 1)
+	}
+	return nil
+}
+
+// recv takes a value from in, ok is false when in is closed, ctx is done or
+// stop is closed. In a Pipeline the value and the wait count to the stage
+// stats.
+func recv(ctx context.Context, in <-chan interface{}, stop <-chan struct{}) (v interface{}, ok bool) {
+	select {
+	case <-stop:
+		return
+	case <-ctx.Done():
+		return
+	default:
+	}
+	st := stageOf(ctx)
+
+	select {
+	case v, ok = <-in:
+	default:
+		start := time.Now()
+		select {
+		case v, ok = <-in:
+		case <-stop:
+		case <-ctx.Done():
+		}
+		if st != nil {
+			addDuration(&st.recvBlocked, start)
+		}
+	}
+
+	if ok && st != nil {
+		atomic.AddUint64(&st.itemsIn, 1)
+	}
+	return
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelineError(t *testing.T) {
+	errBroken := errors.New("broken")
+
+	var sent, collected uint32
+	jobs := []errJob{
+		errJob(func(in, out chan interface{}) error {
+			for i := 0; i < MaxInputDataLen; i++ {
+				out <- i
+				atomic.AddUint32(&sent, 1)
+			}
+			return nil
+		}),
+		errJob(func(in, out chan interface{}) error {
+			for v := range in {
+				if v.(int) == 3 {
+					return errBroken
+				}
+				out <- v
+			}
+			return nil
+		}),
+		errJob(func(in, out chan interface{}) error {
+			for range in {
+				atomic.AddUint32(&collected, 1)
+			}
+			return nil
+		}),
+	}
+
+	err := ExecutePipelineE(jobs...)
+
+	if !errors.Is(err, errBroken) {
+		t.Errorf("unexpected error\nGot: %v\nExpected: %v", err, errBroken)
+	}
+	if sent != MaxInputDataLen {
+		t.Errorf("producer was not drained, sent = %d", sent)
+	}
+	if collected > 3 {
+		t.Errorf("values passed the failed job, collected = %d", collected)
+	}
+}
+
+func TestSingleHashBadInput(t *testing.T) {
+	jobs := []errJob{
+		errJob(func(in, out chan interface{}) error {
+			out <- 3.14
+			return nil
+		}),
+		errJob(SingleHashE),
+		errJob(MultiHashE),
+		errJob(CombineResultsE),
+	}
+
+	err := ExecutePipelineE(jobs...)
+
+	inputErr := &UnexpectedInputError{}
+	if !errors.As(err, &inputErr) || inputErr.Stage != "SingleHash" || inputErr.Value != 3.14 {
+		t.Errorf("expected an input error from SingleHash, got %v", err)
+	}
+}
+
+func TestPipelineDeadline(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	jobs := []ctxJob{
+		ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+			for i := 0; ; i++ {
+				if err := send(ctx, out, i); err != nil {
+					return err
+				}
+			}
+		}),
+		ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+			for v := range in {
+				time.Sleep(time.Millisecond)
+				out <- v
+			}
+			return nil
+		}),
+		ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+			for range in {
+			}
+			return nil
+		}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := ExecutePipelineCtx(ctx, jobs...)
+	end := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error\nGot: %v\nExpected: %v", err, context.DeadlineExceeded)
+	}
+	if expectedTime := 200 * time.Millisecond; end > expectedTime {
+		t.Errorf("pipeline was not stopped in time\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+
+	// горутины могут завершаться чуть позже возврата из wg.Wait
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked\nGot: %d\nExpected: <=%d", after, before)
+	}
+}
+
+func TestPipelineStats(t *testing.T) {
+	const items = 20
+
+	p := &Pipeline{
+		Stages: []StageConfig{
+			{
+				Name: "producer",
+				Job: func(ctx context.Context, in, out chan interface{}) error {
+					for i := 0; i < items; i++ {
+						if err := send(ctx, out, i); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:   "slow",
+				Buffer: 5,
+				Job: func(ctx context.Context, in, out chan interface{}) error {
+					for {
+						v, ok := recv(ctx, in, nil)
+						if !ok {
+							return ctx.Err()
+						}
+						time.Sleep(time.Millisecond)
+						if err := send(ctx, out, v); err != nil {
+							return err
+						}
+					}
+				},
+			},
+			{
+				Name: "sink",
+				Job: func(ctx context.Context, in, out chan interface{}) error {
+					for {
+						if _, ok := recv(ctx, in, nil); !ok {
+							return ctx.Err()
+						}
+					}
+				},
+			},
+		},
+	}
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stats := p.Stats()
+	if len(stats) != 3 {
+		t.Fatalf("stats for every stage expected, got %d", len(stats))
+	}
+	producer, slow, sink := stats[0], stats[1], stats[2]
+
+	if producer.ItemsOut != items || slow.ItemsIn != items || slow.ItemsOut != items || sink.ItemsIn != items {
+		t.Errorf("items lost\nGot: %+v", stats)
+	}
+	// узкое место - slow, значит producer упирается в него, а sink его ждет
+	if producer.SendBlocked < slow.SendBlocked {
+		t.Errorf("producer should be blocked by slow\nGot: %+v", stats)
+	}
+	if sink.RecvBlocked == 0 || sink.RecvBlocked < slow.RecvBlocked {
+		t.Errorf("sink should wait for slow\nGot: %+v", stats)
+	}
+	if slow.QueueDepth != 0 {
+		t.Errorf("queue should be empty after run\nGot: %+v", stats)
+	}
+}
+
+func TestPipelineQueueDepth(t *testing.T) {
+	t.Parallel()
+
+	// без буфера значение передается из рук в руки, как в ExecutePipeline
+	for _, buffer := range []int{0, 3} {
+		var sent int32
+		release := make(chan struct{})
+		p := &Pipeline{
+			Stages: []StageConfig{
+				{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+					for i := 0; i < 10; i++ {
+						out <- i
+						atomic.AddInt32(&sent, 1)
+					}
+				}))},
+				{Buffer: buffer, Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+					<-release
+					for range in {
+					}
+				}))},
+			},
+		}
+
+		done := make(chan error)
+		go func() {
+			done <- p.Run(context.Background())
+		}()
+
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(&sent) < int32(buffer) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if n := atomic.LoadInt32(&sent); n != int32(buffer) {
+			t.Errorf("buffer %d: unexpected number of values sent ahead\nGot: %d\nExpected: %d", buffer, n, buffer)
+		}
+		if depth := p.Stats()[1].QueueDepth; depth != buffer {
+			t.Errorf("buffer %d: unexpected queue depth\nGot: %d\nExpected: %d", buffer, depth, buffer)
+		}
+
+		close(release)
+		if err := <-done; err != nil {
+			t.Fatalf("buffer %d: unexpected error: %v", buffer, err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type itemFunc func(ctx context.Context, v interface{}) (interface{}, error)
+
+type poolResult struct {
+	v   interface{}
+	err error
+}
+
+type poolTask struct {
+	v   interface{}
+	res chan poolResult
+}
+
+// WorkerPool makes a job that calls fn for every input value with at most
+// workers calls in flight. Unordered results leave as soon as they are ready;
+// ordered ones keep the input order.
+//
+// When a call panics and the stage skips panics, only that value is dropped.
+// Otherwise the pool takes no more input, sends the results of the calls in
+// flight and returns the PanicError, so a restarted job loses nothing else.
+func WorkerPool(workers int, ordered bool, fn itemFunc) ctxJob {
+	if workers < 1 {
+		workers = 1
+	}
+	if ordered {
+		return orderedPool(workers, fn)
+	}
+	return unorderedPool(workers, fn)
+}
+
+func unorderedPool(workers int, fn itemFunc) ctxJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		stop := make(chan struct{})
+		var (
+			once sync.Once
+			ferr error
+		)
+		fail := func(err error) {
+			once.Do(func() {
+				ferr = err
+				if isPanic(err) {
+					close(stop)
+				} else {
+					cancel()
+				}
+			})
+		}
+
+		wg := &sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for {
+					v, ok := recv(ctx, in, stop)
+					if !ok {
+						return
+					}
+
+					res, err := callItem(ctx, fn, v)
+					if skipItem(ctx, err) {
+						continue
+					}
+					if err == nil {
+						err = send(ctx, out, res)
+					}
+					if err != nil {
+						fail(err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		return ferr
+	}
+}
+
+func orderedPool(workers int, fn itemFunc) ctxJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		tasks := make(chan poolTask)
+		// the window of values being processed, in the input order
+		pending := make(chan chan poolResult, workers)
+		stop := make(chan struct{})
+
+		go func() {
+			defer close(pending)
+			defer close(tasks)
+
+			for {
+				v, ok := recv(ctx, in, stop)
+				if !ok {
+					return
+				}
+
+				res := make(chan poolResult, 1)
+				select {
+				case pending <- res:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case tasks <- poolTask{v: v, res: res}:
+				case <-ctx.Done():
+					res <- poolResult{err: ctx.Err()}
+					return
+				}
+			}
+		}()
+
+		wg := &sync.WaitGroup{}
+		defer wg.Wait()
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for t := range tasks {
+					v, err := callItem(ctx, fn, t.v)
+					t.res <- poolResult{v: v, err: err}
+				}
+			}()
+		}
+
+		var (
+			ferr      error
+			stopped   bool
+			cancelled bool
+		)
+		for res := range pending {
+			r := <-res
+			if cancelled {
+				continue
+			}
+
+			err := r.err
+			if skipItem(ctx, err) {
+				continue
+			}
+			if err == nil {
+				err = send(ctx, out, r.v)
+			}
+			if err == nil {
+				continue
+			}
+
+			if ferr == nil {
+				ferr = err
+			}
+			if !isPanic(err) {
+				cancel()
+				cancelled = true
+			} else if !stopped {
+				close(stop)
+				stopped = true
+			}
+		}
+
+		return ferr
+	}
+}
+
+func isPanic(err error) bool {
+	var perr *PanicError
+	return errors.As(err, &perr)
+}
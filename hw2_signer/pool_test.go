@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolOrdered(t *testing.T) {
+	const workers = 4
+
+	var inFlight, maxInFlight int32
+	square := itemFunc(func(ctx context.Context, v interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			top := atomic.LoadInt32(&maxInFlight)
+			if n <= top || atomic.CompareAndSwapInt32(&maxInFlight, top, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		return v.(int) * v.(int), nil
+	})
+
+	var result []int
+	err := ExecutePipelineCtx(context.Background(),
+		fromErrJob(fromJob(func(in, out chan interface{}) {
+			for i := 0; i < 50; i++ {
+				out <- i
+			}
+		})),
+		WorkerPool(workers, true, square),
+		fromErrJob(fromJob(func(in, out chan interface{}) {
+			for v := range in {
+				result = append(result, v.(int))
+			}
+		})),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, v := range result {
+		if v != i*i {
+			t.Fatalf("input order is broken at %d\nGot: %v", i, result)
+		}
+	}
+	if len(result) != 50 {
+		t.Errorf("items lost, got %d", len(result))
+	}
+	if maxInFlight > workers {
+		t.Errorf("too many workers\nGot: %d\nExpected: <=%d", maxInFlight, workers)
+	}
+}
+
+func TestStageWorkers(t *testing.T) {
+	var recieved uint32
+	p := &Pipeline{
+		Stages: []StageConfig{
+			{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				for i := 0; i < 10; i++ {
+					out <- i
+				}
+			}))},
+			// 10 значений по 50мс на 10 воркерах - примерно 50мс
+			{Workers: 10, Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				for v := range in {
+					time.Sleep(50 * time.Millisecond)
+					out <- v
+				}
+			}))},
+			{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				for range in {
+					atomic.AddUint32(&recieved, 1)
+				}
+			}))},
+		},
+	}
+
+	start := time.Now()
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	end := time.Since(start)
+
+	if recieved != 10 {
+		t.Errorf("items lost, recieved = %d", recieved)
+	}
+	if expectedTime := 200 * time.Millisecond; end > expectedTime {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+}
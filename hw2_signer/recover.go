@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// What to do when a job of the stage panics.
+const (
+	// PolicyFail stops the pipeline with a PanicError.
+	PolicyFail = iota
+	// PolicySkip makes a WorkerPool job drop the value that panicked and go on
+	// without a restart. Any other job is restarted after the Backoff pause, a
+	// fixed one, and the value it was busy with is lost. Pipeline configs
+	// allow skip for the pool jobs only.
+	PolicySkip
+	// PolicyRestart starts the job again after a pause, doubled on every restart.
+	PolicyRestart
+)
+
+// The bounds of the pause before a restart, so that a job panicking at once
+// does not spin.
+const (
+	minRestartPause = 10 * time.Millisecond
+	maxRestartPause = time.Minute
+)
+
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error gives the stack only for a value other than an error: an error tells
+// what went wrong by itself, the stack is still in Stack.
+func (e *PanicError) Error() string {
+	if err, ok := e.Value.(error); ok {
+		return "panic: " + err.Error()
+	}
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap gives access to the error the job panicked with, if any.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+func newPanicError(v interface{}) *PanicError {
+	if perr, ok := v.(*PanicError); ok {
+		return perr
+	}
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+// catch calls fn and returns what it panicked with. The jobs use it in the
+// goroutines they start themselves, to re-panic in the job goroutine.
+func catch(fn func()) (perr *PanicError) {
+	defer func() {
+		if v := recover(); v != nil {
+			perr = newPanicError(v)
+		}
+	}()
+
+	fn()
+	return
+}
+
+func callJob(ctx context.Context, j ctxJob, in, out chan interface{}) (ferr error) {
+	defer func() {
+		if v := recover(); v != nil {
+			ferr = newPanicError(v)
+		}
+	}()
+
+	return j(ctx, in, out)
+}
+
+func callItem(ctx context.Context, fn itemFunc, v interface{}) (res interface{}, ferr error) {
+	defer func() {
+		if p := recover(); p != nil {
+			ferr = newPanicError(p)
+		}
+	}()
+
+	return fn(ctx, v)
+}
+
+type skipPanicsKey struct{}
+
+// skipItem tells a pool whether the value that gave err should be dropped.
+// It is so for a panic in a stage with PolicySkip.
+func skipItem(ctx context.Context, err error) bool {
+	var perr *PanicError
+	if !errors.As(err, &perr) {
+		return false
+	}
+	skip, _ := ctx.Value(skipPanicsKey{}).(func() bool)
+	return skip != nil && skip()
+}
+
+// runJob calls the stage job and applies the stage panic policy. The
+// restarts are counted in st, so MaxRestarts limits all the job copies.
+func runJob(ctx context.Context, sc StageConfig, st *stageStats, in, out chan interface{}) error {
+	// values dropped by pools count as restarts
+	if sc.OnPanic == PolicySkip {
+		ctx = context.WithValue(ctx, skipPanicsKey{}, func() bool {
+			if !st.addRestart(sc.MaxRestarts) {
+				return false
+			}
+			st.addPanic()
+			return true
+		})
+	}
+
+	backoff := sc.Backoff
+	if backoff < minRestartPause {
+		backoff = minRestartPause
+	}
+	if backoff > maxRestartPause {
+		backoff = maxRestartPause
+	}
+	for {
+		err := callJob(ctx, sc.Job, in, out)
+
+		var perr *PanicError
+		if !errors.As(err, &perr) {
+			return err
+		}
+		st.addPanic()
+
+		if sc.OnPanic == PolicyFail || !st.addRestart(sc.MaxRestarts) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		if sc.OnPanic == PolicyRestart {
+			if backoff > maxRestartPause/2 {
+				backoff = maxRestartPause
+			} else {
+				backoff *= 2
+			}
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelinePanic(t *testing.T) {
+	t.Parallel()
+
+	err := ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- struct{}{}
+		}),
+		job(SingleHash),
+		job(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)
+
+	perr := &PanicError{}
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a PanicError, got %v", err)
+	}
+	if !strings.Contains(string(perr.Stack), "SingleHash") {
+		t.Errorf("stack trace doesnt point to SingleHash:\n%s", perr.Stack)
+	}
+	inputErr := &UnexpectedInputError{}
+	if !errors.As(err, &inputErr) {
+		t.Errorf("the input error is lost: %v", err)
+	}
+}
+
+type panickySigner struct {
+	FastSigner
+}
+
+func (panickySigner) Crc32(data string) string {
+	panic("crc32 is broken")
+}
+
+type md5PanickySigner struct {
+	FastSigner
+}
+
+func (md5PanickySigner) Md5(data string) string {
+	panic("md5 is broken")
+}
+
+// не параллельный: считает горутины
+func TestHasherSignerPanic(t *testing.T) {
+	h := &Hasher{Signer: panickySigner{}}
+	err := ExecutePipelineE(
+		func(in, out chan interface{}) error {
+			out <- "1~2"
+			return nil
+		},
+		h.MultiHashE,
+	)
+
+	perr := &PanicError{}
+	if !errors.As(err, &perr) || perr.Value != "crc32 is broken" {
+		t.Errorf("expected a PanicError from the signer, got %v", err)
+	}
+
+	// после паники md5 горутины crc32(data) не остаются висеть
+	before := runtime.NumGoroutine()
+	h = &Hasher{Signer: md5PanickySigner{}}
+	err = ExecutePipelineE(
+		func(in, out chan interface{}) error {
+			for i := 0; i < 20; i++ {
+				out <- i
+			}
+			return nil
+		},
+		h.SingleHashE,
+	)
+	if !errors.As(err, &perr) || perr.Value != "md5 is broken" {
+		t.Errorf("expected a PanicError from the signer, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines leak\nGot: %d\nExpected: <=%d", n, before)
+	}
+}
+
+func TestPanicPolicySkip(t *testing.T) {
+	t.Parallel()
+
+	var result []int
+	p := &Pipeline{
+		Stages: []StageConfig{
+			{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				for i := 0; i < 5; i++ {
+					out <- i
+				}
+			}))},
+			{OnPanic: PolicySkip, Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				for v := range in {
+					if v.(int)%2 == 1 {
+						panic("odd value")
+					}
+					out <- v
+				}
+			}))},
+			{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				for v := range in {
+					result = append(result, v.(int))
+				}
+			}))},
+		},
+	}
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{0, 2, 4}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	if panics := p.Stats()[1].Panics; panics != 2 {
+		t.Errorf("unexpected number of panics %d", panics)
+	}
+}
+
+func TestPanicPolicyRestart(t *testing.T) {
+	t.Parallel()
+
+	const backoff = 10 * time.Millisecond
+
+	runs := 0
+	p := &Pipeline{
+		Stages: []StageConfig{
+			{OnPanic: PolicyRestart, Backoff: backoff, MaxRestarts: 3, Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				runs++
+				panic("not ready yet")
+			}))},
+		},
+	}
+
+	start := time.Now()
+	err := p.Run(context.Background())
+	end := time.Since(start)
+
+	if !errors.As(err, new(*PanicError)) {
+		t.Errorf("expected a PanicError after the last restart, got %v", err)
+	}
+	if runs != 4 {
+		t.Errorf("unexpected number of runs\nGot: %d\nExpected: %d", runs, 4)
+	}
+	// паузы 10, 20 и 40мс
+	if minTime := 7 * backoff; end < minTime {
+		t.Errorf("backoff is not respected\nGot: %s\nExpected: >=%s", end, minTime)
+	}
+}
+
+func TestPanicPolicyRestartWorkers(t *testing.T) {
+	t.Parallel()
+
+	var runs int32
+	p := &Pipeline{
+		Stages: []StageConfig{
+			{OnPanic: PolicyRestart, Workers: 4, MaxRestarts: 3, Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				atomic.AddInt32(&runs, 1)
+				panic("not ready yet")
+			}))},
+		},
+	}
+
+	if err := p.Run(context.Background()); !errors.As(err, new(*PanicError)) {
+		t.Errorf("expected a PanicError after the last restart, got %v", err)
+	}
+	// MaxRestarts на всю стадию, а не на каждую копию
+	if maxRuns := int32(4 + 3); runs > maxRuns {
+		t.Errorf("too many runs\nGot: %d\nExpected: <=%d", runs, maxRuns)
+	}
+}
+
+type poisonedSigner struct {
+	FastSigner
+}
+
+func (s poisonedSigner) Crc32(data string) string {
+	if strings.Contains(data, "poison") {
+		panic("poisoned input")
+	}
+	time.Sleep(10 * time.Millisecond)
+	return s.FastSigner.Crc32(data)
+}
+
+func TestPanicPolicySkipPool(t *testing.T) {
+	t.Parallel()
+
+	h := &Hasher{Signer: poisonedSigner{}}
+
+	var inputs []string
+	for i := 0; i < 20; i++ {
+		inputs = append(inputs, strconv.Itoa(i))
+	}
+	inputs[7] = "poison"
+
+	var result []string
+	p := &Pipeline{
+		Stages: []StageConfig{
+			{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				for _, data := range inputs {
+					out <- data
+				}
+			}))},
+			{OnPanic: PolicySkip, Job: fromErrJob(h.MultiHashE)},
+			{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				for v := range in {
+					result = append(result, v.(string))
+				}
+			}))},
+		},
+	}
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// теряется только отравленное значение
+	var expected []string
+	for _, data := range inputs {
+		if data != "poison" {
+			expected = append(expected, (&Hasher{Signer: FastSigner{}}).multiHash(data))
+		}
+	}
+	sort.Strings(result)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestPanicPolicySkipItem(t *testing.T) {
+	t.Parallel()
+
+	for _, ordered := range []bool{false, true} {
+		runs := int32(0)
+		var result []int
+		p := &Pipeline{
+			Stages: []StageConfig{
+				{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+					for i := 0; i < 10; i++ {
+						out <- i
+					}
+				}))},
+				{OnPanic: PolicySkip, Job: func(ctx context.Context, in, out chan interface{}) error {
+					atomic.AddInt32(&runs, 1)
+					return WorkerPool(3, ordered, func(ctx context.Context, v interface{}) (interface{}, error) {
+						if v.(int)%3 == 0 {
+							panic("multiple of three")
+						}
+						return v, nil
+					})(ctx, in, out)
+				}},
+				{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+					for v := range in {
+						result = append(result, v.(int))
+					}
+				}))},
+			},
+		}
+
+		if err := p.Run(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ordered {
+			sort.Ints(result)
+		}
+		if expected := []int{1, 2, 4, 5, 7, 8}; !reflect.DeepEqual(result, expected) {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+		}
+		// пул не перезапускается, паники все равно считаются
+		if runs != 1 {
+			t.Errorf("the pool is restarted %d times", runs-1)
+		}
+		if panics := p.Stats()[1].Panics; panics != 4 {
+			t.Errorf("unexpected number of panics %d", panics)
+		}
+	}
+}
+
+func TestPanicPolicySkipAlwaysPanics(t *testing.T) {
+	t.Parallel()
+
+	const timeout = 200 * time.Millisecond
+
+	var runs int32
+	p := &Pipeline{
+		Stages: []StageConfig{
+			{Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				out <- 1
+			}))},
+			{OnPanic: PolicySkip, Job: fromErrJob(fromJob(func(in, out chan interface{}) {
+				atomic.AddInt32(&runs, 1)
+				panic("never works")
+			}))},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.Run(ctx)
+	end := time.Since(start)
+
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if end > 5*timeout {
+		t.Errorf("deadline is not respected: %s", end)
+	}
+	// перезапуски идут с паузой, а не в цикле
+	if maxRuns := int32(timeout/minRestartPause) + 2; runs > maxRuns {
+		t.Errorf("too many restarts\nGot: %d\nExpected: <=%d", runs, maxRuns)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+var ErrNoWorkers = errors.New("no alive signer workers")
+
+const rpcDialTimeout = time.Second
+
+// SignArgs is a hashing request. A Salt other than the one of the worker
+// Signer is refused unless it is a SaltedSigner, so a worker started with
+// another salt cannot give wrong hashes.
+type SignArgs struct {
+	Data string
+	Salt string
+}
+
+type signerService struct {
+	signer Signer
+}
+
+func (s *signerService) check(args SignArgs) error {
+	if args.Salt != saltOf(s.signer) && !canSalt(s.signer) {
+		return fmt.Errorf("salt mismatch: worker has %q, request has %q", saltOf(s.signer), args.Salt)
+	}
+	return nil
+}
+
+func (s *signerService) Md5(args SignArgs, res *string) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	*res = signMd5(s.signer, args.Data, args.Salt)
+	return nil
+}
+
+func (s *signerService) Crc32(args SignArgs, res *string) error {
+	if err := s.check(args); err != nil {
+		return err
+	}
+	*res = signCrc32(s.signer, args.Data, args.Salt)
+	return nil
+}
+
+func (s *signerService) Ping(_ struct{}, _ *struct{}) error {
+	return nil
+}
+
+// SignerServer serves the Signer calls over net/rpc, see RPCSigner.
+type SignerServer struct {
+	Signer Signer
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// Serve accepts connections on l until Close.
+func (s *SignerServer) Serve(l net.Listener) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Signer", &signerService{signer: s.Signer}); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return l.Close()
+	}
+	s.listener = l
+	s.conns = map[net.Conn]struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go func() {
+			server.ServeConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops Serve and drops the open connections, the calls in flight
+// are lost.
+func (s *SignerServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+type rpcWorker struct {
+	addr   string
+	client *rpc.Client
+	alive  bool
+}
+
+// RPCSigner sends the Signer calls to SignerServer workers in turn. A worker
+// whose connection breaks is skipped and the call is repeated on the next
+// one; the health check pings the workers and brings the dead ones back when
+// they answer again. When no worker is alive, a call waits a health check
+// interval before the next attempt. When every attempt fails the call panics,
+// which the pipeline reports as a PanicError.
+type RPCSigner struct {
+	// Retries is the number of repeated attempts after a failed call
+	Retries int
+
+	healthInterval time.Duration
+
+	mu      sync.Mutex
+	workers []*rpcWorker
+	next    int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewRPCSigner makes a signer for the workers at addrs, pinging them every
+// healthInterval, zero disables the health check.
+func NewRPCSigner(healthInterval time.Duration, addrs ...string) *RPCSigner {
+	s := &RPCSigner{
+		Retries:        len(addrs),
+		healthInterval: healthInterval,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		s.workers = append(s.workers, &rpcWorker{addr: addr, alive: true})
+	}
+
+	if healthInterval > 0 {
+		go s.healthLoop(healthInterval)
+	} else {
+		close(s.done)
+	}
+	return s
+}
+
+func (s *RPCSigner) Md5(data string) string {
+	return s.call("Signer.Md5", data, DataSignerSalt)
+}
+
+func (s *RPCSigner) Crc32(data string) string {
+	return s.call("Signer.Crc32", data, DataSignerSalt)
+}
+
+// SaltedMd5 asks the workers for another salt, which only the workers with
+// a SaltedSigner accept.
+func (s *RPCSigner) SaltedMd5(data, salt string) string {
+	return s.call("Signer.Md5", data, salt)
+}
+
+func (s *RPCSigner) SaltedCrc32(data, salt string) string {
+	return s.call("Signer.Crc32", data, salt)
+}
+
+// Alive returns the addresses of the workers in use.
+func (s *RPCSigner) Alive() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var addrs []string
+	for _, w := range s.workers {
+		if w.alive {
+			addrs = append(addrs, w.addr)
+		}
+	}
+	return addrs
+}
+
+// Close stops the health check and closes the connections.
+func (s *RPCSigner) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if w.client != nil {
+			w.client.Close()
+			w.client = nil
+		}
+	}
+	return nil
+}
+
+func (s *RPCSigner) call(method, data, salt string) string {
+	var (
+		lastErr error
+		waited  bool
+	)
+	// with no alive workers, the call gives up only after a health check
+	for attempt := 0; attempt <= s.Retries || (errors.Is(lastErr, ErrNoWorkers) && !waited); attempt++ {
+		if errors.Is(lastErr, ErrNoWorkers) {
+			if !s.waitHealthCheck() {
+				break
+			}
+			waited = true
+		}
+
+		w, client, err := s.pick()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var res string
+		err = client.Call(method, SignArgs{Data: data, Salt: salt}, &res)
+		if err == nil {
+			return res
+		}
+
+		var serverErr rpc.ServerError
+		if errors.As(err, &serverErr) {
+			// the worker is fine, it has refused the request
+			panic(fmt.Errorf("%s on %s: %w", method, w.addr, err))
+		}
+		s.markDead(w, client)
+		lastErr = fmt.Errorf("%s on %s: %w", method, w.addr, err)
+	}
+
+	panic(lastErr)
+}
+
+// waitHealthCheck sleeps for a health check interval. It returns false at
+// once if there is no health check or the signer is closed.
+func (s *RPCSigner) waitHealthCheck() bool {
+	if s.healthInterval <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(s.healthInterval)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// pick returns the next alive worker, connecting to it if needed. The dial
+// is done without the lock, so it does not hold back the other calls.
+func (s *RPCSigner) pick() (*rpcWorker, *rpc.Client, error) {
+	for range s.workers {
+		s.mu.Lock()
+		var w *rpcWorker
+		for range s.workers {
+			next := s.workers[s.next]
+			s.next = (s.next + 1) % len(s.workers)
+			if next.alive {
+				w = next
+				break
+			}
+		}
+		if w == nil {
+			s.mu.Unlock()
+			return nil, nil, ErrNoWorkers
+		}
+		client := w.client
+		s.mu.Unlock()
+
+		if client != nil {
+			return w, client, nil
+		}
+
+		client, err := dialWorker(w.addr)
+
+		s.mu.Lock()
+		if err != nil {
+			if w.client == nil {
+				w.alive = false
+			}
+			s.mu.Unlock()
+			continue
+		}
+		if w.client != nil {
+			client.Close()
+			client = w.client
+		} else {
+			w.client = client
+		}
+		s.mu.Unlock()
+
+		return w, client, nil
+	}
+
+	return nil, nil, ErrNoWorkers
+}
+
+func (s *RPCSigner) markDead(w *rpcWorker, client *rpc.Client) {
+	s.mu.Lock()
+	if w.client == client {
+		w.client = nil
+		w.alive = false
+	}
+	s.mu.Unlock()
+
+	client.Close()
+}
+
+func (s *RPCSigner) healthLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+
+		s.mu.Lock()
+		workers := append([]*rpcWorker(nil), s.workers...)
+		s.mu.Unlock()
+
+		for _, w := range workers {
+			s.checkWorker(w, interval)
+		}
+	}
+}
+
+// checkWorker pings w and updates its state. A worker that does not answer
+// within timeout is dropped, which also fails the calls waiting on it.
+func (s *RPCSigner) checkWorker(w *rpcWorker, timeout time.Duration) {
+	s.mu.Lock()
+	client := w.client
+	s.mu.Unlock()
+
+	if client == nil {
+		var err error
+		client, err = dialWorker(w.addr)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if w.client != nil {
+			client.Close()
+			client = w.client
+		} else {
+			w.client = client
+		}
+		s.mu.Unlock()
+	}
+
+	call := client.Go("Signer.Ping", struct{}{}, &struct{}{}, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			s.markDead(w, client)
+			return
+		}
+	case <-time.After(timeout):
+		s.markDead(w, client)
+		return
+	}
+
+	s.mu.Lock()
+	if w.client == client {
+		w.alive = true
+	}
+	s.mu.Unlock()
+}
+
+func dialWorker(addr string) (*rpc.Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, rpcDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClient(conn), nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startWorker запускает SignerServer на свободном порту localhost
+func startWorker(t *testing.T, s Signer) (*SignerServer, string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &SignerServer{Signer: s}
+	go server.Serve(l)
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	return server, l.Addr().String()
+}
+
+func TestRPCSigner(t *testing.T) {
+	t.Parallel()
+
+	_, first := startWorker(t, FastSigner{})
+	_, second := startWorker(t, FastSigner{})
+
+	rs := NewRPCSigner(0, first, second)
+	defer rs.Close()
+
+	values := []int{0, 1, 1, 2, 3, 5, 8}
+	expected, err := signValues(context.Background(), &Hasher{Signer: FastSigner{}}, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err := signValues(context.Background(), &Hasher{Signer: rs}, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.Result != expected.Result {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res.Result, expected.Result)
+	}
+}
+
+func TestRPCSignerWorkerDeath(t *testing.T) {
+	t.Parallel()
+
+	dying, first := startWorker(t, FastSigner{})
+	_, second := startWorker(t, FastSigner{})
+
+	rs := NewRPCSigner(10*time.Millisecond, first, second)
+	defer rs.Close()
+
+	h := &Hasher{Signer: rs}
+	expected := (&Hasher{Signer: FastSigner{}}).singleHash("0")
+	if res := h.singleHash("0"); res != expected {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+
+	// воркер умирает с открытыми соединениями - вызовы уходят на второй
+	dying.Close()
+	for i := 0; i < 5; i++ {
+		if res := h.singleHash("0"); res != expected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(rs.Alive()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("health check did not drop the dead worker, alive: %v", rs.Alive())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if alive := rs.Alive(); alive[0] != second {
+		t.Errorf("wrong worker dropped, alive: %v", alive)
+	}
+}
+
+func TestRPCSignerNoWorkers(t *testing.T) {
+	t.Parallel()
+
+	dead, addr := startWorker(t, FastSigner{})
+	dead.Close()
+
+	rs := NewRPCSigner(0, addr)
+	defer rs.Close()
+
+	err := ExecutePipelineE(
+		func(in, out chan interface{}) error {
+			out <- 0
+			return nil
+		},
+		(&Hasher{Signer: rs}).SingleHashE,
+		func(in, out chan interface{}) error {
+			for range in {
+			}
+			return nil
+		},
+	)
+
+	perr := &PanicError{}
+	if !errors.As(err, &perr) || !errors.Is(err, ErrNoWorkers) {
+		t.Errorf("expected a PanicError with ErrNoWorkers, got %v", err)
+	}
+	if strings.Contains(err.Error(), "goroutine") {
+		t.Errorf("stack trace in the error message:\n%v", err)
+	}
+}
+
+func TestRPCSignerSalt(t *testing.T) {
+	t.Parallel()
+
+	_, salted := startWorker(t, FastSigner{})
+	_, plain := startWorker(t, DataSigner{})
+
+	rs := NewRPCSigner(0, salted)
+	defer rs.Close()
+
+	if res, expected := rs.SaltedMd5("0", "salt"), (FastSigner{}).SaltedMd5("0", "salt"); res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+
+	// воркер с DataSigner не умеет другую соль и отказывает
+	rp := NewRPCSigner(0, plain)
+	defer rp.Close()
+
+	perr := catch(func() {
+		rp.SaltedCrc32("0", "salt")
+	})
+	if perr == nil {
+		t.Error("expected a salt mismatch")
+	}
+
+	// и кеш поверх DataSigner тоже, хоть у него и есть SaltedCrc32
+	_, cached := startWorker(t, NewSignerCache(DataSigner{}, 10))
+	rc := NewRPCSigner(0, cached)
+	defer rc.Close()
+
+	perr = catch(func() {
+		rc.SaltedCrc32("0", "salt")
+	})
+	if perr == nil || !strings.Contains(perr.Error(), "salt mismatch") {
+		t.Errorf("expected a salt mismatch, got %v", perr)
+	}
+}
+
+func TestRPCSignerWaitsForWorker(t *testing.T) {
+	t.Parallel()
+
+	dead, addr := startWorker(t, FastSigner{})
+	dead.Close()
+
+	rs := NewRPCSigner(10*time.Millisecond, addr)
+	rs.Retries = 50
+	defer rs.Close()
+
+	// воркер поднимается, пока вызов ждет проверки здоровья
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		server := &SignerServer{Signer: FastSigner{}}
+		go server.Serve(l)
+		t.Cleanup(func() {
+			server.Close()
+		})
+	}()
+
+	var res string
+	perr := catch(func() {
+		res = rs.Md5("0")
+	})
+	if perr != nil {
+		t.Fatalf("unexpected panic: %v", perr)
+	}
+	if expected := (FastSigner{}).Md5("0"); res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+}
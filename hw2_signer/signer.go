@@ -1,122 +1,369 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // сюда писать код
 
-func ExecutePipeline(jobs ...job) {
-	wg := &sync.WaitGroup{}
-	defer wg.Wait()
+// ExecutePipeline returns an error only when some job panics.
+func ExecutePipeline(jobs ...job) error {
+	errJobs := make([]errJob, 0, len(jobs))
+	for _, j := range jobs {
+		errJobs = append(errJobs, fromJob(j))
+	}
+
+	return ExecutePipelineE(errJobs...)
+}
 
-	in := make(chan interface{})
+type UnexpectedInputError struct {
+	Stage string
+	Value interface{}
+}
 
-	for _, j := range jobs {
-		out := make(chan interface{})
+func (e *UnexpectedInputError) Error() string {
+	return fmt.Sprintf("%s: unexpected input %#v of type %T", e.Stage, e.Value, e.Value)
+}
+
+func unexpectedInput(stage string, v interface{}) error {
+	return &UnexpectedInputError{Stage: stage, Value: v}
+}
+
+// inputData turns a SingleHash input into the string to hash: integers of
+// any width are written in decimal, strings and byte slices are taken as is,
+// named integer and string types too, even with a String method. Other
+// fmt.Stringer values give their String.
+func inputData(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case []byte:
+		return string(x), true
+	}
 
-		wg.Add(1)
-		go jobWorker(j, in, out, wg)
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.String:
+		return rv.String(), true
+	}
 
-		in = out
+	if x, ok := v.(fmt.Stringer); ok {
+		return x.String(), true
 	}
+	return "", false
 }
 
-func jobWorker(j job, in, out chan interface{}, wg *sync.WaitGroup) {
-	defer wg.Done()
-	defer close(out)
+// Hasher runs SingleHash and MultiHash with the given Signer.
+type Hasher struct {
+	Signer Signer
+	// Logf prints the hashing steps as in hw2.md, nil disables it
+	Logf func(format string, args ...interface{})
+	// Tracer records the hashing steps, nil disables it
+	Tracer *Tracer
+
+	// Rounds is the number of crc32 calls in MultiHash, 6 when zero.
+	Rounds int
+	// Prefixes are put before the data in the MultiHash rounds, one per
+	// round, and override Rounds. The round numbers 0, 1, ... when empty.
+	Prefixes []string
+	// Separator joins the MultiHash rounds.
+	Separator string
+
+	// Checkpoint saves the SingleHash and MultiHash results, nil disables it
+	Checkpoint *Checkpoint
+
+	// Salt replaces the salt of the Signer when not nil, the Signer has to be
+	// a SaltedSigner for another salt.
+	Salt *string
+
+	// Workers is the number of values SingleHash and MultiHash hash at
+	// once. Every value takes a second of crc32 at least, so by default it is
+	// MaxInputDataLen, the most inputs hw2 expects.
+	Workers int
+}
+
+func (h *Hasher) salt() string {
+	if h.Salt != nil {
+		return *h.Salt
+	}
+	return saltOf(h.Signer)
+}
+
+func (h *Hasher) md5(data string) string {
+	return signMd5(h.Signer, data, h.salt())
+}
+
+func (h *Hasher) crc32(data string) string {
+	return signCrc32(h.Signer, data, h.salt())
+}
+
+const defaultRounds = 6
 
-	j(in, out)
+func (h *Hasher) workers() int {
+	if h.Workers <= 0 {
+		return MaxInputDataLen
+	}
+	return h.Workers
+}
+
+// multiHashPrefixes returns the prefix of every MultiHash round.
+func (h *Hasher) multiHashPrefixes() []string {
+	if len(h.Prefixes) > 0 {
+		return h.Prefixes
+	}
+
+	rounds := h.Rounds
+	if rounds <= 0 {
+		rounds = defaultRounds
+	}
+	prefixes := make([]string, rounds)
+	for i := range prefixes {
+		prefixes[i] = strconv.Itoa(i)
+	}
+	return prefixes
+}
+
+var defaultHasher = &Hasher{Signer: DataSigner{}}
+
+func (h *Hasher) step(stage, item, step, result string, start time.Time) {
+	s := Span{Stage: stage, Item: item, Step: step, Result: result, Start: start, End: SignerClock.Now()}
+	h.Tracer.Record(s)
+	if h.Logf != nil {
+		h.Logf("%s", s.Text())
+	}
 }
 
 func SingleHash(in, out chan interface{}) {
-	wg := &sync.WaitGroup{}
-	defer wg.Wait()
+	defaultHasher.SingleHash(in, out)
+}
 
-	for v := range in {
-		data := strconv.Itoa(v.(int))
+func SingleHashE(in, out chan interface{}) error {
+	return defaultHasher.SingleHashE(in, out)
+}
+
+// SingleHashOrdered is SingleHash that keeps the input order in its output.
+func SingleHashOrdered(in, out chan interface{}) {
+	defaultHasher.SingleHashOrdered(in, out)
+}
+
+func (h *Hasher) SingleHash(in, out chan interface{}) {
+	mustJob(h.SingleHashE)(in, out)
+}
+
+func (h *Hasher) SingleHashE(in, out chan interface{}) error {
+	return WorkerPool(h.workers(), false, h.singleHashItem)(context.Background(), in, out)
+}
+
+func (h *Hasher) SingleHashOrdered(in, out chan interface{}) {
+	mustCtxJob(WorkerPool(h.workers(), true, h.singleHashItem))(in, out)
+}
 
-		wg.Add(1)
-		go singleHash(out, data, wg)
+func (h *Hasher) singleHashItem(ctx context.Context, v interface{}) (interface{}, error) {
+	data, ok := inputData(v)
+	if !ok {
+		return nil, unexpectedInput("SingleHash", v)
 	}
+
+	h.step("SingleHash", data, "data", data, SignerClock.Now())
+
+	return h.checkpointed("SingleHash", data, h.singleHash)
 }
 
-var mu = &sync.Mutex{}
+var (
+	md5SchedulerOnce sync.Once
+	md5Scheduler     *Md5Scheduler
+)
 
 func DataSignerMd5Wrapper(data string) string {
-	defer mu.Unlock()
-	mu.Lock()
-	return DataSignerMd5(data)
+	md5SchedulerOnce.Do(func() {
+		md5Scheduler = NewMd5Scheduler(0)
+	})
+	return md5Scheduler.Sign(data)
 }
 
-func crc32ll(data string, out chan<- string) {
-	out <- DataSignerCrc32(data)
+// crc32ll sends the hash to out, or the PanicError if the signer panicked.
+func (h *Hasher) crc32ll(data string, out chan<- interface{}) {
+	var res string
+	perr := catch(func() {
+		start := SignerClock.Now()
+		res = h.crc32(data)
+		h.step("SingleHash", data, "crc32(data)", res, start)
+	})
+	if perr != nil {
+		out <- perr
+		return
+	}
+	out <- res
 }
 
-func singleHash(out chan interface{}, data string, wg *sync.WaitGroup) {
-	defer wg.Done()
+func (h *Hasher) singleHash(data string) string {
+	start := SignerClock.Now()
 
-	leftChan := make(chan string)
-	go crc32ll(data, leftChan)
+	// buffered, so crc32ll does not hang if md5 panics and nobody reads it
+	leftChan := make(chan interface{}, 1)
+	go h.crc32ll(data, leftChan)
 
-	right := DataSignerCrc32(DataSignerMd5Wrapper(data))
+	md5 := h.md5(data)
+	h.step("SingleHash", data, "md5(data)", md5, start)
+	crcStart := SignerClock.Now()
+	right := h.crc32(md5)
+	h.step("SingleHash", data, "crc32(md5(data))", right, crcStart)
 
-	left := <-leftChan
+	leftRes := <-leftChan
+	if perr, ok := leftRes.(*PanicError); ok {
+		panic(perr)
+	}
+	left := leftRes.(string)
 
-	out <- left + "~" + right
+	res := left + "~" + right
+	h.step("SingleHash", data, "result", res, start)
+	return res
 }
 
 func MultiHash(in, out chan interface{}) {
-	wg := &sync.WaitGroup{}
-	defer wg.Wait()
+	defaultHasher.MultiHash(in, out)
+}
 
-	for v := range in {
-		data := v.(string)
+func MultiHashE(in, out chan interface{}) error {
+	return defaultHasher.MultiHashE(in, out)
+}
+
+// MultiHashOrdered is MultiHash that keeps the input order in its output.
+func MultiHashOrdered(in, out chan interface{}) {
+	defaultHasher.MultiHashOrdered(in, out)
+}
+
+func (h *Hasher) MultiHash(in, out chan interface{}) {
+	mustJob(h.MultiHashE)(in, out)
+}
 
-		wg.Add(1)
-		go multiHashWorker(out, data, wg)
+func (h *Hasher) MultiHashE(in, out chan interface{}) error {
+	return WorkerPool(h.workers(), false, h.multiHashItem)(context.Background(), in, out)
+}
+
+func (h *Hasher) MultiHashOrdered(in, out chan interface{}) {
+	mustCtxJob(WorkerPool(h.workers(), true, h.multiHashItem))(in, out)
+}
+
+func (h *Hasher) multiHashItem(ctx context.Context, v interface{}) (interface{}, error) {
+	data, ok := v.(string)
+	if !ok {
+		return nil, unexpectedInput("MultiHash", v)
 	}
+
+	return h.checkpointed(h.multiHashStage(), data, h.multiHash)
 }
 
-const th = 5
+// multiHashStage names MultiHash in the checkpoint, the rounds other than
+// the default ones are a part of the name.
+func (h *Hasher) multiHashStage() string {
+	if len(h.Prefixes) == 0 && (h.Rounds <= 0 || h.Rounds == defaultRounds) && h.Separator == "" {
+		return "MultiHash"
+	}
+	return fmt.Sprintf("MultiHash %q %q", h.multiHashPrefixes(), h.Separator)
+}
 
-func crc32ToArr(arr *[th + 1]string, i int, data string, wg *sync.WaitGroup) {
+func (h *Hasher) crc32ToArr(arr []string, panics []*PanicError, i int, prefix, data string, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	arr[i] = DataSignerCrc32(data)
+	panics[i] = catch(func() {
+		start := SignerClock.Now()
+		arr[i] = h.crc32(prefix + data)
+		h.step("MultiHash", data, "crc32(th+step1)) "+strconv.Itoa(i), arr[i], start)
+	})
 }
 
-func multiHashWorker(out chan interface{}, data string, wg *sync.WaitGroup) {
-	defer wg.Done()
+func (h *Hasher) multiHash(data string) string {
+	start := SignerClock.Now()
 
-	var arr [th + 1]string
+	prefixes := h.multiHashPrefixes()
+	arr := make([]string, len(prefixes))
+	panics := make([]*PanicError, len(prefixes))
 
 	wgn := &sync.WaitGroup{}
 
-	for i := 0; i <= th; i++ {
+	for i, prefix := range prefixes {
 		wgn.Add(1)
-		go crc32ToArr(&arr, i, strconv.Itoa(i)+data, wgn)
+		go h.crc32ToArr(arr, panics, i, prefix, data, wgn)
 	}
 
 	wgn.Wait()
 
-	res := strings.Join(arr[:], "")
-	out <- res
+	for _, perr := range panics {
+		if perr != nil {
+			panic(perr)
+		}
+	}
+
+	res := strings.Join(arr, h.Separator)
+	h.step("MultiHash", data, "result", res, start)
+	return res
 }
 
 func CombineResults(in, out chan interface{}) {
+	mustJob(CombineResultsE)(in, out)
+}
+
+func CombineResultsE(in, out chan interface{}) error {
+	return defaultHasher.CombineResultsE(in, out)
+}
+
+// CombineResultsArrival joins results in the order they came, so with the
+// ordered hashers the signature follows the input order.
+func CombineResultsArrival(in, out chan interface{}) {
+	mustJob(func(in, out chan interface{}) error {
+		res, err := joinResults(in, false)
+		if err != nil {
+			return err
+		}
+		out <- res
+		return nil
+	})(in, out)
+}
+
+func (h *Hasher) CombineResults(in, out chan interface{}) {
+	mustJob(h.CombineResultsE)(in, out)
+}
+
+func (h *Hasher) CombineResultsE(in, out chan interface{}) error {
+	start := SignerClock.Now()
+
+	res, err := joinResults(in, true)
+	if err != nil {
+		return err
+	}
+	h.step("CombineResults", "", "", res, start)
+
+	out <- res
+
+	return nil
+}
+
+func joinResults(in chan interface{}, sorted bool) (string, error) {
 	var input []string
 
 	for v := range in {
-		input = append(input, v.(string))
+		data, ok := v.(string)
+		if !ok {
+			return "", unexpectedInput("CombineResults", v)
+		}
+		input = append(input, data)
 	}
 
-	sort.Strings(input)
-
-	res := strings.Join(input, "_")
+	if sorted {
+		sort.Strings(input)
+	}
 
-	out <- res
+	return strings.Join(input, "_"), nil
 }
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jitterSigner это FastSigner со случайной задержкой, которая перемешивает порядок готовности
+type jitterSigner struct {
+	FastSigner
+}
+
+func (s jitterSigner) Crc32(data string) string {
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+	return s.FastSigner.Crc32(data)
+}
+
+// countingSigner считает вызовы Crc32
+type countingSigner struct {
+	Signer
+	crc32Calls uint32
+}
+
+func (s *countingSigner) Crc32(data string) string {
+	atomic.AddUint32(&s.crc32Calls, 1)
+	return s.Signer.Crc32(data)
+}
+
+func TestSignerOrdered(t *testing.T) {
+	t.Parallel()
+
+	h := &Hasher{Signer: jitterSigner{}}
+	inputData := []int{5, 3, 8, 0, 1, 1, 2, 13, 21}
+
+	var expected []string
+	for _, v := range inputData {
+		expected = append(expected, h.multiHash(h.singleHash(strconv.Itoa(v))))
+	}
+	testExpected := strings.Join(expected, "_")
+
+	testResult := "NOT_SET"
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, v := range inputData {
+				out <- v
+			}
+		}),
+		job(h.SingleHashOrdered),
+		job(h.MultiHashOrdered),
+		job(CombineResultsArrival),
+		job(func(in, out chan interface{}) {
+			testResult = (<-in).(string)
+		}),
+	)
+
+	if testResult != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
+	}
+}
+
+func TestSigners(t *testing.T) {
+	t.Parallel()
+
+	// значения из hw2.md
+	fast := &Hasher{Signer: FastSigner{}}
+	if res := fast.multiHash(fast.singleHash("0")); res != "29568666068035183841425683795340791879727309630931025356555" {
+		t.Errorf("FastSigner doesnt match DataSigner, got %v", res)
+	}
+
+	// эталонные значения XXH64
+	for data, expected := range map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+		"Nobody inspects the spammish repetition": 0xfbcea83c8a378bf1,
+	} {
+		if res := xxh64([]byte(data)); res != expected {
+			t.Errorf("xxh64(%q)\nGot: %x\nExpected: %x", data, res, expected)
+		}
+	}
+
+	for _, s := range []Signer{SHA256Signer{}, XXHashSigner{}} {
+		h := &Hasher{Signer: s}
+		first, second := h.singleHash("1"), h.singleHash("2")
+		if first == second || first != h.singleHash("1") {
+			t.Errorf("%T is not a stable hash: %v, %v", s, first, second)
+		}
+	}
+}
+
+func TestMd5Scheduler(t *testing.T) {
+	var overheats uint32
+	lockOrig := OverheatLock
+	t.Cleanup(func() {
+		OverheatLock = lockOrig
+	})
+	OverheatLock = func() {
+		if !atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1) {
+			atomic.AddUint32(&overheats, 1)
+			lockOrig()
+		}
+	}
+
+	s := NewMd5Scheduler(0)
+	defer s.Close()
+
+	const callers = 10
+	results := make([]string, callers)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = s.Sign(strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, res := range results {
+		if expected := fmt.Sprintf("%x", md5.Sum([]byte(strconv.Itoa(i)+DataSignerSalt))); res != expected {
+			t.Errorf("wrong md5 for %d\nGot: %v\nExpected: %v", i, res, expected)
+		}
+	}
+	if overheats != 0 {
+		t.Errorf("overheat happend %d times", overheats)
+	}
+
+	stats := s.Stats()
+	if stats.Served != callers {
+		t.Errorf("not all requests served, stats = %+v", stats)
+	}
+	// последний в очереди ждет всех остальных
+	if minWait := (callers - 2) * Md5Cost; stats.MaxWait < minWait {
+		t.Errorf("wait time is not accounted\nGot: %s\nExpected: >=%s", stats.MaxWait, minWait)
+	}
+}
+
+func TestMd5SchedulersShareLock(t *testing.T) {
+	var overheats uint32
+	lockOrig := OverheatLock
+	t.Cleanup(func() {
+		OverheatLock = lockOrig
+	})
+	OverheatLock = func() {
+		if !atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1) {
+			atomic.AddUint32(&overheats, 1)
+			lockOrig()
+		}
+	}
+
+	s := NewMd5Scheduler(0)
+	defer s.Close()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			s.Sign(strconv.Itoa(i))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			DataSignerMd5Wrapper(strconv.Itoa(i + 100))
+		}(i)
+	}
+	wg.Wait()
+
+	if overheats != 0 {
+		t.Errorf("overheat happend %d times", overheats)
+	}
+}
+
+func TestMd5SchedulerShared(t *testing.T) {
+	var (
+		calls   uint32
+		release = make(chan struct{})
+	)
+	s := newMd5Scheduler(0, realClock{}, func(data string) string {
+		atomic.AddUint32(&calls, 1)
+		<-release
+		return FastSigner{}.Md5(data)
+	})
+	s.Dedup = true
+	defer s.Close()
+
+	// пока первый вызов висит, все повторы встают в очередь
+	inputs := []string{"1", "2", "1", "1", "2", "3"}
+	results := make([]string, len(inputs))
+	wg := &sync.WaitGroup{}
+	for i, data := range inputs {
+		wg.Add(1)
+		go func(i int, data string) {
+			defer wg.Done()
+			results[i] = s.Sign(data)
+		}(i, data)
+	}
+	for {
+		s.mu.Lock()
+		pending := len(s.pending)
+		s.mu.Unlock()
+		if pending == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// повторам тоже надо успеть присоединиться
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, data := range inputs {
+		if expected := (FastSigner{}).Md5(data); results[i] != expected {
+			t.Errorf("wrong md5 for %s\nGot: %v\nExpected: %v", data, results[i], expected)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("duplicates are hashed again: %d calls for 3 distinct inputs", calls)
+	}
+	if stats := s.Stats(); stats.Served != uint64(len(inputs)) || stats.Shared != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMd5SchedulerPanic(t *testing.T) {
+	md5Orig := DataSignerMd5
+	t.Cleanup(func() {
+		DataSignerMd5 = md5Orig
+	})
+	DataSignerMd5 = func(data string) string {
+		if data == "poison" {
+			panic("md5 is broken")
+		}
+		return FastSigner{}.Md5(data)
+	}
+
+	s := NewMd5Scheduler(0)
+	defer s.Close()
+
+	perr := catch(func() {
+		s.Sign("poison")
+	})
+	if perr == nil || perr.Value != "md5 is broken" {
+		t.Fatalf("expected the panic in the caller, got %v", perr)
+	}
+
+	// планировщик пережил панику и обслуживает следующих
+	if res, expected := s.Sign("0"), (FastSigner{}).Md5("0"); res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+}
+
+type stringerInput struct{}
+
+func (stringerInput) String() string {
+	return "42"
+}
+
+// числовой тип со String хешируется по значению, а не по тексту
+type enumInput int
+
+func (enumInput) String() string {
+	return "enum"
+}
+
+type nameInput string
+
+func TestSingleHashInputTypes(t *testing.T) {
+	t.Parallel()
+
+	h := &Hasher{Signer: FastSigner{}}
+	testExpected := h.singleHash("42")
+	inputData := []interface{}{42, int8(42), int64(42), uint32(42), uint64(42), "42", []byte("42"), stringerInput{},
+		enumInput(42), time.Duration(42), nameInput("42")}
+
+	var result []string
+	err := ExecutePipelineE(
+		func(in, out chan interface{}) error {
+			for _, v := range inputData {
+				out <- v
+			}
+			return nil
+		},
+		h.SingleHashE,
+		func(in, out chan interface{}) error {
+			for v := range in {
+				result = append(result, v.(string))
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result) != len(inputData) {
+		t.Fatalf("items lost, got %v", result)
+	}
+	for _, res := range result {
+		if res != testExpected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", res, testExpected)
+		}
+	}
+}
+
+func TestMultiHashFanWidth(t *testing.T) {
+	t.Parallel()
+
+	crc := FastSigner{}.Crc32
+	cases := []struct {
+		h        *Hasher
+		expected string
+	}{
+		// по умолчанию шесть раундов с префиксами 0..5, как в hw2.md
+		{&Hasher{Signer: FastSigner{}}, "29568666068035183841425683795340791879727309630931025356555"},
+		{&Hasher{Signer: FastSigner{}, Rounds: 2}, crc("0x") + crc("1x")},
+		{&Hasher{Signer: FastSigner{}, Prefixes: []string{"a", "b", "c"}, Separator: "-"}, crc("ax") + "-" + crc("bx") + "-" + crc("cx")},
+	}
+
+	for i, c := range cases {
+		data := "x"
+		if i == 0 {
+			data = c.h.singleHash("0")
+		}
+		if res := c.h.multiHash(data); res != c.expected {
+			t.Errorf("case %d: results not match\nGot: %v\nExpected: %v", i, res, c.expected)
+		}
+	}
+}
+
+// busySigner считает, сколько Md5 идут одновременно
+type busySigner struct {
+	FastSigner
+	busy, maxBusy int32
+}
+
+func (s *busySigner) Md5(data string) string {
+	n := atomic.AddInt32(&s.busy, 1)
+	defer atomic.AddInt32(&s.busy, -1)
+	for {
+		max := atomic.LoadInt32(&s.maxBusy)
+		if n <= max || atomic.CompareAndSwapInt32(&s.maxBusy, max, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return s.FastSigner.Md5(data)
+}
+
+func TestHasherWorkers(t *testing.T) {
+	t.Parallel()
+
+	s := &busySigner{}
+	h := &Hasher{Signer: s, Workers: 2}
+
+	err := ExecutePipelineE(
+		func(in, out chan interface{}) error {
+			for i := 0; i < 10; i++ {
+				out <- i
+			}
+			return nil
+		},
+		h.SingleHashE,
+		func(in, out chan interface{}) error {
+			for range in {
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s.maxBusy != 2 {
+		t.Errorf("pool is not bounded by Workers: %d values at once", s.maxBusy)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Signer computes the two hashes of the signature scheme. The methods are
+// named after the roles in hw2.md, a backend is free to use other algorithms.
+// The data is hashed with the salt of the signer, DataSignerSalt unless the
+// signer has a salt of its own; see SaltedSigner for other salts.
+type Signer interface {
+	Md5(data string) string
+	Crc32(data string) string
+}
+
+// saltOf returns the salt s hashes with.
+func saltOf(s Signer) string {
+	if ss, ok := s.(interface{ salt() string }); ok {
+		return ss.salt()
+	}
+	return DataSignerSalt
+}
+
+// DataSigner calls DataSignerMd5 through the Md5 scheduler and
+// DataSignerCrc32 as they are at the moment of the call.
+type DataSigner struct{}
+
+func (DataSigner) Md5(data string) string {
+	return DataSignerMd5Wrapper(data)
+}
+
+func (DataSigner) Crc32(data string) string {
+	return DataSignerCrc32(data)
+}
+
+// ClockedSigner hashes as DataSigner does, but sleeps on Clock, so tests can
+// run it on a virtual one: an md5 takes Md5Cost, a crc32 takes a second, and
+// an md5 started while another one runs waits for the overheat a second at a
+// time. Like DataSigner, it sends its md5 calls through an Md5Scheduler.
+type ClockedSigner struct {
+	Clock Clock
+
+	once      sync.Once
+	scheduler *Md5Scheduler
+	overheat  uint32
+}
+
+func (s *ClockedSigner) Md5(data string) string {
+	s.once.Do(func() {
+		s.scheduler = newMd5Scheduler(0, s.Clock, s.md5)
+	})
+	return s.scheduler.Sign(data)
+}
+
+func (s *ClockedSigner) Crc32(data string) string {
+	data += DataSignerSalt
+	dataHash := strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data))), 10)
+	s.Clock.Sleep(time.Second)
+	return dataHash
+}
+
+// Close stops the md5 scheduler, the signer must not be used after it.
+func (s *ClockedSigner) Close() {
+	s.once.Do(func() {})
+	if s.scheduler != nil {
+		s.scheduler.Close()
+	}
+}
+
+// md5 is DataSignerMd5 on Clock.
+func (s *ClockedSigner) md5(data string) string {
+	s.overheatLock()
+	defer s.overheatUnlock()
+
+	data += DataSignerSalt
+	dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
+	s.Clock.Sleep(Md5Cost)
+	return dataHash
+}
+
+func (s *ClockedSigner) overheatLock() {
+	for !atomic.CompareAndSwapUint32(&s.overheat, 0, 1) {
+		fmt.Println("OverheatLock happend")
+		s.Clock.Sleep(time.Second)
+	}
+}
+
+func (s *ClockedSigner) overheatUnlock() {
+	for !atomic.CompareAndSwapUint32(&s.overheat, 1, 0) {
+		fmt.Println("OverheatUnlock happend")
+		s.Clock.Sleep(time.Second)
+	}
+}
+
+// SaltedSigner is a Signer that can also hash with a salt other than its
+// own, as Hasher.Salt needs.
+type SaltedSigner interface {
+	Signer
+	SaltedMd5(data, salt string) string
+	SaltedCrc32(data, salt string) string
+}
+
+var ErrUnsaltedSigner = errors.New("signer cannot hash with another salt")
+
+// signMd5 hashes data with salt, through the plain Md5 when the salt is the
+// one of s. It panics if another salt is asked of a plain Signer.
+func signMd5(s Signer, data, salt string) string {
+	if salt == saltOf(s) {
+		return s.Md5(data)
+	}
+	return mustSalted(s).SaltedMd5(data, salt)
+}
+
+func signCrc32(s Signer, data, salt string) string {
+	if salt == saltOf(s) {
+		return s.Crc32(data)
+	}
+	return mustSalted(s).SaltedCrc32(data, salt)
+}
+
+// canSalt tells if s can hash with a salt other than its own.
+func canSalt(s Signer) bool {
+	if c, ok := s.(*SignerCache); ok {
+		return c.signer != nil && canSalt(c.signer)
+	}
+	_, ok := s.(SaltedSigner)
+	return ok
+}
+
+func mustSalted(s Signer) SaltedSigner {
+	ss, ok := s.(SaltedSigner)
+	if !ok {
+		panic(fmt.Errorf("%w: %T", ErrUnsaltedSigner, s))
+	}
+	return ss
+}
+
+// FastSigner gives the same results as DataSigner with DataSignerSalt set to
+// Salt, but without the sleeps and the overheat lock. Meant for tests.
+type FastSigner struct {
+	Salt string
+}
+
+func (s FastSigner) salt() string {
+	return s.Salt
+}
+
+func (s FastSigner) Md5(data string) string {
+	return s.SaltedMd5(data, s.Salt)
+}
+
+func (s FastSigner) Crc32(data string) string {
+	return s.SaltedCrc32(data, s.Salt)
+}
+
+func (FastSigner) SaltedMd5(data, salt string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(data+salt)))
+}
+
+func (FastSigner) SaltedCrc32(data, salt string) string {
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+salt))), 10)
+}
+
+type SHA256Signer struct {
+	Salt string
+}
+
+func (s SHA256Signer) salt() string {
+	return s.Salt
+}
+
+func (s SHA256Signer) Md5(data string) string {
+	return s.SaltedMd5(data, s.Salt)
+}
+
+func (s SHA256Signer) Crc32(data string) string {
+	return s.SaltedCrc32(data, s.Salt)
+}
+
+func (SHA256Signer) SaltedMd5(data, salt string) string {
+	sum := sha256.Sum256([]byte(data + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+func (SHA256Signer) SaltedCrc32(data, salt string) string {
+	sum := sha256.Sum256([]byte(data + salt))
+	return strconv.FormatUint(uint64(binary.BigEndian.Uint32(sum[:4])), 10)
+}
+
+// XXHashSigner uses XXH64 with a zero seed.
+type XXHashSigner struct {
+	Salt string
+}
+
+func (s XXHashSigner) salt() string {
+	return s.Salt
+}
+
+func (s XXHashSigner) Md5(data string) string {
+	return s.SaltedMd5(data, s.Salt)
+}
+
+func (s XXHashSigner) Crc32(data string) string {
+	return s.SaltedCrc32(data, s.Salt)
+}
+
+func (XXHashSigner) SaltedMd5(data, salt string) string {
+	return fmt.Sprintf("%016x", xxh64([]byte(data+salt)))
+}
+
+func (XXHashSigner) SaltedCrc32(data, salt string) string {
+	return strconv.FormatUint(uint64(uint32(xxh64([]byte(data+salt)))), 10)
+}
+
+// vars rather than consts: the seeding arithmetic relies on uint64 wrapping
+var (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * xxhPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxhPrime1
+}
+
+func xxhMergeRound(acc, val uint64) uint64 {
+	acc ^= xxhRound(0, val)
+	return acc*xxhPrime1 + xxhPrime4
+}
+
+func xxh64(b []byte) uint64 {
+	n := len(b)
+
+	var h uint64
+	if n >= 32 {
+		v1 := xxhPrime1 + xxhPrime2
+		v2 := xxhPrime2
+		v3 := uint64(0)
+		v4 := -xxhPrime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = xxhRound(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = xxhRound(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = xxhRound(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = xxhRound(v4, binary.LittleEndian.Uint64(b[24:32]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) +
+			bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxhMergeRound(h, v1)
+		h = xxhMergeRound(h, v2)
+		h = xxhMergeRound(h, v3)
+		h = xxhMergeRound(h, v4)
+	} else {
+		h = xxhPrime5
+	}
+
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxhRound(0, binary.LittleEndian.Uint64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * xxhPrime1
+		h = bits.RotateLeft64(h, 23)*xxhPrime2 + xxhPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxhPrime5
+		h = bits.RotateLeft64(h, 11) * xxhPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxhPrime2
+	h ^= h >> 29
+	h *= xxhPrime3
+	h ^= h >> 32
+
+	return h
+}
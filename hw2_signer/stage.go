@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stage is a typed job. Stages are composed with Then, so a stage that
+// produces strings can't be wired to one that expects ints.
+type Stage[In, Out any] func(ctx context.Context, in <-chan In, out chan<- Out) error
+
+var (
+	SingleHashStage     = Typed[int, string](fromErrJob(SingleHashE))
+	MultiHashStage      = Typed[string, string](fromErrJob(MultiHashE))
+	CombineResultsStage = Typed[string, string](fromErrJob(CombineResultsE))
+)
+
+func Then[A, B, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(ctx context.Context, in <-chan A, out chan<- C) error {
+		return ExecutePipelineCtx(ctx, sourceJob(in), first.Job(), second.Job(), sinkJob(out))
+	}
+}
+
+// Typed wraps an untyped job. Values of unexpected types coming out of it
+// fail the stage.
+func Typed[In, Out any](j ctxJob) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In, out chan<- Out) error {
+		return ExecutePipelineCtx(ctx, sourceJob(in), j, sinkJob(out))
+	}
+}
+
+// Job adapts the stage to ExecutePipelineCtx.
+func (s Stage[In, Out]) Job() ctxJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		typedIn := make(chan In)
+		typedOut := make(chan Out)
+
+		var convErr error
+		convDone := make(chan struct{})
+		go func() {
+			defer close(convDone)
+			defer close(typedIn)
+
+			for v := range in {
+				tv, ok := v.(In)
+				if !ok {
+					convErr = unexpectedInput(fmt.Sprintf("Stage[%T, %T]", tv, *new(Out)), v)
+					cancel()
+					return
+				}
+				select {
+				case typedIn <- tv:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		stageErr := make(chan error, 1)
+		go func() {
+			defer close(typedOut)
+			err := s(ctx, typedIn, typedOut)
+			if err != nil {
+				cancel()
+			}
+			stageErr <- err
+		}()
+
+		for v := range typedOut {
+			out <- v
+		}
+
+		err := <-stageErr
+		cancel()
+		<-convDone
+
+		if convErr != nil {
+			return convErr
+		}
+		return err
+	}
+}
+
+// RunStage feeds inputs to the stage and collects everything it produces.
+func RunStage[In, Out any](ctx context.Context, s Stage[In, Out], inputs []In) ([]Out, error) {
+	var outputs []Out
+
+	err := ExecutePipelineCtx(ctx,
+		ctxJob(func(ctx context.Context, _, out chan interface{}) error {
+			for _, v := range inputs {
+				if err := send(ctx, out, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		s.Job(),
+		ctxJob(func(ctx context.Context, in, _ chan interface{}) error {
+			for v := range in {
+				outputs = append(outputs, v.(Out))
+			}
+			return nil
+		}),
+	)
+
+	return outputs, err
+}
+
+func sourceJob[T any](in <-chan T) ctxJob {
+	return func(ctx context.Context, _, out chan interface{}) error {
+		for v := range in {
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func sinkJob[T any](out chan<- T) ctxJob {
+	return func(ctx context.Context, in, _ chan interface{}) error {
+		for {
+			v, ok := recv(ctx, in, nil)
+			if !ok {
+				return ctx.Err()
+			}
+			tv, ok := v.(T)
+			if !ok {
+				return unexpectedInput(fmt.Sprintf("Stage output %T", tv), v)
+			}
+			select {
+			case out <- tv:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
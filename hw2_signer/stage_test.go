@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestStageThen(t *testing.T) {
+	square := Stage[int, int](func(ctx context.Context, in <-chan int, out chan<- int) error {
+		for v := range in {
+			out <- v * v
+		}
+		return nil
+	})
+	format := Stage[int, string](func(ctx context.Context, in <-chan int, out chan<- string) error {
+		for v := range in {
+			out <- "#" + strconv.Itoa(v)
+		}
+		return nil
+	})
+
+	result, err := RunStage(context.Background(), Then(square, format), []int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"#1", "#4", "#9"}
+	if len(result) != len(expected) {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Fatalf("results not match\nGot: %v\nExpected: %v", result, expected)
+		}
+	}
+}
+
+func TestStageTypedMismatch(t *testing.T) {
+	// job не соответствует объявленному типу выхода - это должно стать ошибкой, а не паникой
+	liar := Typed[int, int](fromErrJob(fromJob(func(in, out chan interface{}) {
+		for v := range in {
+			out <- strconv.Itoa(v.(int))
+		}
+	})))
+
+	_, err := RunStage(context.Background(), liar, []int{1, 2, 3})
+	if err == nil {
+		t.Errorf("expected an error for a mismatched output")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Span is a timed step: a pipeline stage run when Item is empty, or a step
+// of hashing one item.
+type Span struct {
+	Stage  string
+	Item   string
+	Step   string
+	Result string
+	Start  time.Time
+	End    time.Time
+}
+
+// Text formats the span as the debug output in hw2.md. Stage runs have no
+// text form.
+func (s Span) Text() string {
+	switch {
+	case s.Step == "" && s.Result == "":
+		return ""
+	case s.Item == "":
+		return s.Stage + " " + s.Result
+	case s.Stage == "MultiHash" && s.Step == "result":
+		return s.Item + " MultiHash result: " + s.Result
+	case s.Stage == "MultiHash":
+		return s.Item + " MultiHash: " + s.Step + " " + s.Result
+	}
+	return s.Item + " " + s.Stage + " " + s.Step + " " + s.Result
+}
+
+type Tracer struct {
+	mu    sync.Mutex
+	start time.Time
+	spans []Span
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{start: SignerClock.Now()}
+}
+
+// Record adds a finished span, a nil Tracer drops it.
+func (t *Tracer) Record(s Span) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = append(t.spans, s)
+}
+
+// Spans returns the recorded spans in the order they have finished.
+func (t *Tracer) Spans() []Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Span(nil), t.spans...)
+}
+
+func (t *Tracer) WriteText(w io.Writer) error {
+	for _, s := range t.Spans() {
+		text := s.Text()
+		if text == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type chromeEvent struct {
+	Name     string            `json:"name"`
+	Category string            `json:"cat"`
+	Phase    string            `json:"ph"`
+	Ts       int64             `json:"ts"`
+	Dur      int64             `json:"dur"`
+	Pid      int               `json:"pid"`
+	Tid      int               `json:"tid"`
+	Args     map[string]string `json:"args,omitempty"`
+}
+
+// WriteChrome writes the spans in the Chrome trace event format, to be opened
+// in chrome://tracing or Perfetto. Stage runs share the first row, every item
+// gets a row of its own.
+func (t *Tracer) WriteChrome(w io.Writer) error {
+	rows := map[string]int{"": 0}
+	events := []chromeEvent{}
+
+	for _, s := range t.Spans() {
+		row, ok := rows[s.Item]
+		if !ok {
+			row = len(rows)
+			rows[s.Item] = row
+		}
+
+		name := s.Stage
+		if s.Step != "" {
+			name += " " + s.Step
+		}
+
+		ev := chromeEvent{
+			Name:     name,
+			Category: s.Stage,
+			Phase:    "X",
+			Ts:       s.Start.Sub(t.start).Microseconds(),
+			Dur:      s.End.Sub(s.Start).Microseconds(),
+			Pid:      1,
+			Tid:      row,
+		}
+		if s.Item != "" || s.Result != "" {
+			ev.Args = map[string]string{"item": s.Item, "result": s.Result}
+		}
+		events = append(events, ev)
+	}
+
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// вывод из hw2.md для одного значения
+const testTraceText = `0 SingleHash data 0
+0 SingleHash md5(data) cfcd208495d565ef66e7dff9f98764da
+0 SingleHash crc32(md5(data)) 502633748
+0 SingleHash crc32(data) 4108050209
+0 SingleHash result 4108050209~502633748
+4108050209~502633748 MultiHash: crc32(th+step1)) 0 2956866606
+4108050209~502633748 MultiHash: crc32(th+step1)) 1 803518384
+4108050209~502633748 MultiHash: crc32(th+step1)) 2 1425683795
+4108050209~502633748 MultiHash: crc32(th+step1)) 3 3407918797
+4108050209~502633748 MultiHash: crc32(th+step1)) 4 2730963093
+4108050209~502633748 MultiHash: crc32(th+step1)) 5 1025356555
+4108050209~502633748 MultiHash result: 29568666068035183841425683795340791879727309630931025356555
+CombineResults 29568666068035183841425683795340791879727309630931025356555
+`
+
+func sortedLines(text string) []string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+
+	tracer := NewTracer()
+	h := &Hasher{Signer: FastSigner{}, Tracer: tracer}
+	p := &Pipeline{
+		Tracer: tracer,
+		Stages: []StageConfig{
+			{Name: "input", Job: fromErrJob(func(in, out chan interface{}) error {
+				out <- 0
+				return nil
+			})},
+			{Name: "SingleHash", Job: fromErrJob(h.SingleHashE)},
+			{Name: "MultiHash", Job: fromErrJob(h.MultiHashE)},
+			{Name: "CombineResults", Job: fromErrJob(h.CombineResultsE)},
+		},
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	text := new(bytes.Buffer)
+	if err := tracer.WriteText(text); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// шаги одного значения идут параллельно, так что порядок строк не фиксирован
+	result, expected := sortedLines(text.String()), sortedLines(testTraceText)
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", text, testTraceText)
+	}
+
+	chrome := new(bytes.Buffer)
+	if err := tracer.WriteChrome(chrome); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trace := struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}{}
+	if err := json.Unmarshal(chrome.Bytes(), &trace); err != nil {
+		t.Fatalf("cant unpack trace json: %v", err)
+	}
+
+	// 13 шагов хеширования и 4 стадии
+	if len(trace.TraceEvents) != 13+4 {
+		t.Errorf("unexpected number of events %d", len(trace.TraceEvents))
+	}
+	stages := 0
+	for _, ev := range trace.TraceEvents {
+		if ev.Phase != "X" || ev.Dur < 0 || ev.Ts < 0 {
+			t.Errorf("bad event %+v", ev)
+		}
+		if ev.Tid == 0 {
+			stages++
+		}
+	}
+	// у результата CombineResults тоже нет значения, он в той же строке, что и стадии
+	if stages != 4+1 {
+		t.Errorf("stage runs should share the first row, got %d", stages)
+	}
+}
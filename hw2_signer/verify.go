@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrSignatureMismatch = errors.New("signature mismatch")
+
+type SignatureSegment struct {
+	Input     string
+	MultiHash string
+}
+
+type AlteredSegment struct {
+	Input    string
+	Expected string
+	Got      string
+}
+
+// VerifyReport compares a signature with the one the inputs give, segment by
+// segment. A segment is the MultiHash result of an input.
+type VerifyReport struct {
+	Expected string
+	Got      string
+	// Missing are the results of inputs that the signature lacks
+	Missing []SignatureSegment
+	// Extra are the segments no input gives
+	Extra []string
+	// Altered are the segments in place of an input result, but different
+	Altered []AlteredSegment
+	// OutOfOrder is set when the right segments are not sorted
+	OutOfOrder bool
+}
+
+func (r *VerifyReport) OK() bool {
+	return r.Got == r.Expected
+}
+
+func (r *VerifyReport) String() string {
+	if r.OK() {
+		return "signature ok"
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(ErrSignatureMismatch.Error())
+	for _, s := range r.Missing {
+		fmt.Fprintf(b, "\nmissing %s of %q", s.MultiHash, s.Input)
+	}
+	for _, s := range r.Extra {
+		fmt.Fprintf(b, "\nextra %s", s)
+	}
+	for _, s := range r.Altered {
+		fmt.Fprintf(b, "\naltered %s of %q: got %s", s.Expected, s.Input, s.Got)
+	}
+	if r.OutOfOrder {
+		b.WriteString("\nsegments out of order")
+	}
+	return b.String()
+}
+
+// Verify signs inputs with salt as the hw2 pipeline does and compares the
+// result with signature. A salt other than the one of the Signer needs a
+// SaltedSigner, which DataSigner is not.
+func Verify(inputs []interface{}, salt, signature string) (*VerifyReport, error) {
+	return defaultHasher.Verify(inputs, salt, signature)
+}
+
+func (h *Hasher) Verify(inputs []interface{}, salt, signature string) (*VerifyReport, error) {
+	if salt != saltOf(h.Signer) && !canSalt(h.Signer) {
+		return nil, fmt.Errorf("%w: %T", ErrUnsaltedSigner, h.Signer)
+	}
+
+	salted := *h
+	salted.Salt = &salt
+
+	segments, err := salted.signSegments(inputs)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].MultiHash < segments[j].MultiHash
+	})
+
+	expected := make([]string, len(segments))
+	for i, s := range segments {
+		expected[i] = s.MultiHash
+	}
+
+	var got []string
+	if signature != "" {
+		got = strings.Split(signature, "_")
+	}
+
+	r := &VerifyReport{Expected: strings.Join(expected, "_"), Got: signature}
+	if !r.OK() {
+		r.compare(segments, got)
+	}
+	return r, nil
+}
+
+// signSegments returns the MultiHash result of every input, in input order.
+func (h *Hasher) signSegments(inputs []interface{}) ([]SignatureSegment, error) {
+	segments := make([]SignatureSegment, len(inputs))
+	for i, v := range inputs {
+		data, ok := inputData(v)
+		if !ok {
+			return nil, unexpectedInput("SingleHash", v)
+		}
+		segments[i].Input = data
+	}
+
+	i := 0
+	p := &Pipeline{
+		Tracer: h.Tracer,
+		Stages: []StageConfig{
+			{Name: "input", Job: func(ctx context.Context, _, out chan interface{}) error {
+				for _, v := range inputs {
+					if err := send(ctx, out, v); err != nil {
+						return err
+					}
+				}
+				return nil
+			}},
+			{Name: "SingleHash", Job: WorkerPool(h.workers(), true, h.singleHashItem)},
+			{Name: "MultiHash", Job: WorkerPool(h.workers(), true, h.multiHashItem)},
+			{Name: "collect", Job: func(ctx context.Context, in, _ chan interface{}) error {
+				for v := range in {
+					segments[i].MultiHash = v.(string)
+					i++
+				}
+				return nil
+			}},
+		},
+	}
+
+	if err := p.Run(context.Background()); err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+type diffOp struct {
+	kind  byte // '=', '-' for an expected segment, '+' for a got one
+	index int
+	moved bool
+}
+
+// compare fills the mismatch lists from the diff of the sorted expected
+// segments and the got ones. A segment both removed and added is out of
+// order; a removed one next to an added one is altered.
+func (r *VerifyReport) compare(expected []SignatureSegment, got []string) {
+	n, m := len(expected), len(got)
+
+	// lcs[i][j] is the longest common subsequence of expected[i:] and got[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case expected[i].MultiHash == got[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && expected[i].MultiHash == got[j]:
+			ops = append(ops, diffOp{kind: '='})
+			i++
+			j++
+		case j == m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{kind: '-', index: i})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', index: j})
+			j++
+		}
+	}
+
+	// the same segment removed in one place and added in another
+	removed := map[string][]int{}
+	for k, op := range ops {
+		if op.kind == '-' {
+			removed[expected[op.index].MultiHash] = append(removed[expected[op.index].MultiHash], k)
+		}
+	}
+	for k, op := range ops {
+		if op.kind != '+' {
+			continue
+		}
+		if ks := removed[got[op.index]]; len(ks) > 0 {
+			ops[k].moved = true
+			ops[ks[0]].moved = true
+			removed[got[op.index]] = ks[1:]
+			r.OutOfOrder = true
+		}
+	}
+
+	var dels, adds []int
+	flush := func() {
+		for len(dels) > 0 && len(adds) > 0 {
+			s := expected[dels[0]]
+			r.Altered = append(r.Altered, AlteredSegment{Input: s.Input, Expected: s.MultiHash, Got: got[adds[0]]})
+			dels, adds = dels[1:], adds[1:]
+		}
+		for _, d := range dels {
+			r.Missing = append(r.Missing, expected[d])
+		}
+		for _, a := range adds {
+			r.Extra = append(r.Extra, got[a])
+		}
+		dels, adds = nil, nil
+	}
+	for _, op := range ops {
+		switch {
+		case op.kind == '=':
+			flush()
+		case op.moved:
+		case op.kind == '-':
+			dels = append(dels, op.index)
+		default:
+			adds = append(adds, op.index)
+		}
+	}
+	flush()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	h := &Hasher{Signer: FastSigner{}}
+	inputs := []interface{}{0, 1, 1, 2, 3, 5, 8}
+
+	report, err := h.Verify(inputs, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	signature := report.Expected
+	segments := strings.Split(signature, "_")
+
+	// сегмент, принадлежащий одному входу, и вход, которому он принадлежит
+	third := segments[3]
+	var thirdInput string
+	for _, v := range inputs {
+		data, _ := inputData(v)
+		if h.multiHash(h.singleHash(data)) == third {
+			thirdInput = data
+		}
+	}
+
+	join := func(segments ...string) string {
+		return strings.Join(segments, "_")
+	}
+	without := func(i int) []string {
+		return append(append([]string{}, segments[:i]...), segments[i+1:]...)
+	}
+	altered := "9" + third[1:]
+	if altered == third {
+		altered = "8" + third[1:]
+	}
+	swapped := append([]string{}, segments...)
+	swapped[0], swapped[6] = swapped[6], swapped[0]
+
+	cases := []struct {
+		signature string
+		check     func(r *VerifyReport) bool
+	}{
+		{signature, func(r *VerifyReport) bool {
+			return r.OK()
+		}},
+		{join(without(3)...), func(r *VerifyReport) bool {
+			return len(r.Missing) == 1 && r.Missing[0].MultiHash == third && r.Missing[0].Input == thirdInput &&
+				len(r.Extra) == 0 && len(r.Altered) == 0
+		}},
+		{join(append([]string{"000"}, segments...)...), func(r *VerifyReport) bool {
+			return len(r.Extra) == 1 && r.Extra[0] == "000" && len(r.Missing) == 0 && len(r.Altered) == 0
+		}},
+		{join(append(append(segments[:3:3], altered), segments[4:]...)...), func(r *VerifyReport) bool {
+			return len(r.Altered) == 1 && r.Altered[0] == AlteredSegment{Input: thirdInput, Expected: third, Got: altered} &&
+				len(r.Missing) == 0 && len(r.Extra) == 0
+		}},
+		{join(swapped...), func(r *VerifyReport) bool {
+			return r.OutOfOrder && len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Altered) == 0
+		}},
+		{"", func(r *VerifyReport) bool {
+			return len(r.Missing) == len(inputs)
+		}},
+	}
+
+	for i, c := range cases {
+		r, err := h.Verify(inputs, "", c.signature)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if !c.check(r) {
+			t.Errorf("case %d: unexpected report %+v\n%v", i, r, r)
+		}
+	}
+
+	// подпись с другой солью не сходится
+	r, err := h.Verify(inputs, "salt", signature)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.OK() {
+		t.Errorf("signature matched with another salt: %v", r)
+	}
+}
+
+func TestVerifySalt(t *testing.T) {
+	inputs := []interface{}{0, 1, 2}
+
+	salted, err := (&Hasher{Signer: FastSigner{Salt: "salt"}}).Verify(inputs, "salt", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plain, err := (&Hasher{Signer: FastSigner{}}).Verify(inputs, DataSignerSalt, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// проверка с другой солью не мешает подписывать параллельно
+	h := &Hasher{Signer: FastSigner{}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			r, err := h.Verify(inputs, "salt", salted.Expected)
+			if err != nil || !r.OK() {
+				t.Errorf("signature with the salt does not match: %v %v", r, err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		r, err := h.Verify(inputs, DataSignerSalt, plain.Expected)
+		if err != nil || !r.OK() {
+			t.Errorf("signature without the salt does not match: %v %v", r, err)
+			break
+		}
+	}
+	<-done
+
+	for _, s := range []Signer{DataSigner{}, NewSignerCache(DataSigner{}, 10)} {
+		if _, err := (&Hasher{Signer: s}).Verify(inputs, "salt", ""); !errors.Is(err, ErrUnsaltedSigner) {
+			t.Errorf("expected ErrUnsaltedSigner for %T, got %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	CombineOrderAsc = iota
+	CombineOrderDesc
+	CombineOrderAsIs
+)
+
+// WindowCombiner is a streaming CombineResults. Results are collected into
+// tumbling windows, closed by Size items or after Interval since the first
+// item, whichever comes first, and every window is emitted as soon as it is
+// closed. With Running set there is a single window that is emitted after
+// every item.
+type WindowCombiner struct {
+	Size     int
+	Interval time.Duration
+	Running  bool
+	// Separator joins the results, "_" when empty
+	Separator string
+	Order     int
+	// Clock times the Interval, SignerClock when nil
+	Clock Clock
+}
+
+func (c WindowCombiner) separator() string {
+	if c.Separator == "" {
+		return "_"
+	}
+	return c.Separator
+}
+
+// insert puts data into window keeping the window order.
+func (c WindowCombiner) insert(window []string, data string) []string {
+	var i int
+	switch c.Order {
+	case CombineOrderAsc:
+		i = sort.SearchStrings(window, data)
+	case CombineOrderDesc:
+		i = sort.Search(len(window), func(i int) bool {
+			return window[i] < data
+		})
+	default:
+		return append(window, data)
+	}
+
+	window = append(window, "")
+	copy(window[i+1:], window[i:])
+	window[i] = data
+	return window
+}
+
+func (c WindowCombiner) Combine(in, out chan interface{}) {
+	mustCtxJob(c.Job())(in, out)
+}
+
+func (c WindowCombiner) Job() ctxJob {
+	size, interval := c.Size, c.Interval
+	if c.Running {
+		size, interval = 1, 0
+	}
+
+	return func(ctx context.Context, in, out chan interface{}) error {
+		var window []string
+
+		add := func(v interface{}) error {
+			data, ok := v.(string)
+			if !ok {
+				return unexpectedInput("CombineResults", v)
+			}
+			window = c.insert(window, data)
+			return nil
+		}
+		emit := func() error {
+			res := strings.Join(window, c.separator())
+			if !c.Running {
+				window = nil
+			}
+			return send(ctx, out, res)
+		}
+
+		return runWindows(ctx, clockOr(c.Clock), in, size, interval, add, emit)
+	}
+}
+
+func clockOr(c Clock) Clock {
+	if c == nil {
+		return SignerClock
+	}
+	return c
+}
+
+// runWindows reads in and passes every value to add. The values added since
+// the last flush make a window, which is flushed when it has size values,
+// latency after its first value on clock, and when in is closed. Zero size
+// or latency disables the bound.
+func runWindows(ctx context.Context, clock Clock, in <-chan interface{}, size int, latency time.Duration, add func(v interface{}) error, flush func() error) error {
+	var (
+		n      int
+		expire <-chan time.Time
+	)
+
+	emit := func() error {
+		expire = nil
+		if n == 0 {
+			return nil
+		}
+		n = 0
+		return flush()
+	}
+
+	for {
+		select {
+		case v, ok := <-in:
+			if !ok {
+				return emit()
+			}
+
+			if err := add(v); err != nil {
+				return err
+			}
+			n++
+
+			if size > 0 && n >= size {
+				if err := emit(); err != nil {
+					return err
+				}
+			} else if latency > 0 && expire == nil {
+				expire = clock.After(latency)
+			}
+		case <-expire:
+			if err := emit(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
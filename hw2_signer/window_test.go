@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// groupSource отправляет группы значений, делая между ними паузу pause
+func groupSource[T any](pause time.Duration, groups ...[]T) ctxJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		for i, group := range groups {
+			if i > 0 {
+				time.Sleep(pause)
+			}
+			for _, v := range group {
+				if err := send(ctx, out, v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func runCombiner(t *testing.T, c WindowCombiner, pause time.Duration, groups ...[]string) []string {
+	var result []string
+	err := ExecutePipelineCtx(context.Background(),
+		groupSource(pause, groups...),
+		c.Job(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for v := range in {
+				result = append(result, v.(string))
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return result
+}
+
+func TestWindowCombinerSize(t *testing.T) {
+	t.Parallel()
+
+	result := runCombiner(t, WindowCombiner{Size: 2, Order: CombineOrderDesc, Separator: ","}, 0,
+		[]string{"a", "b", "d", "c", "e"})
+	expected := []string{"b,a", "d,c", "e"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestWindowCombinerInterval(t *testing.T) {
+	t.Parallel()
+
+	// между группами пауза дольше окна
+	result := runCombiner(t, WindowCombiner{Interval: 20 * time.Millisecond}, 50*time.Millisecond,
+		[]string{"b", "a"}, []string{"d", "c"}, []string{"e"})
+	expected := []string{"a_b", "c_d", "e"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestWindowCombinerRunning(t *testing.T) {
+	t.Parallel()
+
+	result := runCombiner(t, WindowCombiner{Running: true}, 0,
+		[]string{"c", "a", "b"})
+	expected := []string{"c", "a_c", "a_b_c"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestWindowCombinerVirtualClock(t *testing.T) {
+	clock := NewFakeClock()
+	in, out := make(chan interface{}), make(chan interface{})
+	c := WindowCombiner{Interval: time.Second, Clock: clock}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Job()(context.Background(), in, out)
+		close(out)
+	}()
+
+	in <- "b"
+	in <- "a"
+	if !clock.WaitSleepers(1) {
+		t.Fatal("window does not wait for its interval")
+	}
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case v := <-out:
+		t.Fatalf("window closed before its interval: %v", v)
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	if res := <-out; res != "a_b" {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, "a_b")
+	}
+
+	close(in)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}